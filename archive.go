@@ -0,0 +1,429 @@
+package gormx
+
+// 过期分区归档
+// 删除过期分区前先归档，归档校验通过后才会删除分区，归档失败则保留分区等待下次检查
+// 支持两种方式：
+//  1. ExchangeArchiver 通过 EXCHANGE PARTITION 将分区数据交换到按周期命名的归档表，如 orders_p20250101
+//  2. ExportArchiver 分批导出分区数据，通过可插拔的ArchiveWriter写入，内置gzip压缩的JSONL/CSV文件
+//
+// partition := gormx.NewPartition(db, database, "orders", gormx.PartitionUnitDay, time.Hour*24*30,
+// 	gormx.WithPartitionArchiver(&gormx.ExportArchiver{
+// 		Writer: gormx.NewArchiveFileWriter("/data/archive", gormx.ArchiveFormatJSONL),
+// 	}),
+// )
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrArchiveVerifyFailed 归档校验失败
+var ErrArchiveVerifyFailed = errors.New("partition archive verify failed")
+
+// PartitionArchiver 分区归档，返回nil表示归档已校验通过，之后才会删除分区
+type PartitionArchiver interface {
+	Archive(ctx context.Context, db *gorm.DB, table string, partition string) error
+}
+
+// countPartitionRows 统计分区的行数
+func countPartitionRows(ctx context.Context, db *gorm.DB, table string, partition string) (count int64, err error) {
+	err = db.WithContext(ctx).
+		Raw(fmt.Sprintf("SELECT COUNT(*) FROM %s PARTITION (%s)", table, partition)).
+		Scan(&count).
+		Error
+	return count, err
+}
+
+// ExchangeArchiver 通过 EXCHANGE PARTITION 将分区数据交换到归档表
+// 归档表不存在时按原表结构创建(去掉分区)，交换后校验归档表行数不少于交换前的分区行数且分区已为空
+type ExchangeArchiver struct {
+	TableName func(table string, partition string) string // 归档表名，默认 {table}_{partition}
+}
+
+func (a *ExchangeArchiver) tableName(table string, partition string) string {
+	if a.TableName != nil {
+		return a.TableName(table, partition)
+	}
+	return table + "_" + partition
+}
+
+func (a *ExchangeArchiver) Archive(ctx context.Context, db *gorm.DB, table string, partition string) error {
+	db = db.WithContext(ctx)
+	archiveTable := a.tableName(table, partition)
+	count, err := countPartitionRows(ctx, db, table, partition)
+	if err != nil {
+		return err
+	}
+	if db.Migrator().HasTable(archiveTable) {
+		var archived int64
+		if err := db.Table(archiveTable).Count(&archived).Error; err != nil {
+			return err
+		}
+		if archived > 0 {
+			// 上次已交换但删除分区失败
+			if count == 0 {
+				return nil
+			}
+			return fmt.Errorf("%w: archive table %s is not empty", ErrArchiveVerifyFailed, archiveTable)
+		}
+	} else {
+		if count == 0 {
+			return nil
+		}
+		if err := db.Exec(fmt.Sprintf("CREATE TABLE %s LIKE %s", archiveTable, table)).Error; err != nil {
+			return err
+		}
+		if err := db.Exec(fmt.Sprintf("ALTER TABLE %s REMOVE PARTITIONING", archiveTable)).Error; err != nil {
+			return err
+		}
+	}
+	if err := db.Exec(fmt.Sprintf("ALTER TABLE %s EXCHANGE PARTITION %s WITH TABLE %s", table, partition, archiveTable)).Error; err != nil {
+		return err
+	}
+	// 校验
+	var archived int64
+	if err := db.Table(archiveTable).Count(&archived).Error; err != nil {
+		return err
+	}
+	remaining, err := countPartitionRows(ctx, db, table, partition)
+	if err != nil {
+		return err
+	}
+	if remaining != 0 || archived < count {
+		return fmt.Errorf("%w: partition %s has %d rows, archive table %s has %d rows, expected %d",
+			ErrArchiveVerifyFailed, partition, remaining, archiveTable, archived, count)
+	}
+	return nil
+}
+
+// ArchiveWriter 分区数据导出的写入目标
+type ArchiveWriter interface {
+	// Open 开始导出一个分区
+	Open(ctx context.Context, table string, partition string) (ArchiveFile, error)
+}
+
+// ArchiveFile 一个分区的导出
+type ArchiveFile interface {
+	// Write 写入一批数据，values与columns一一对应
+	Write(columns []string, rows [][]any) error
+	// Commit 完成写入并持久化，返回持久化后校验的行数
+	Commit() (int64, error)
+	// Abort 放弃写入并清理
+	Abort() error
+}
+
+// ExportArchiver 按主键分批导出分区数据
+// 导出完成后校验写入行数与分区行数一致，且导出期间分区没有新增数据
+type ExportArchiver struct {
+	Writer    ArchiveWriter // 写入目标
+	KeyColumn string        // 分批导出使用的递增列，默认id
+	ChunkSize int           // 每批导出的行数，默认1000
+}
+
+func (a *ExportArchiver) Archive(ctx context.Context, db *gorm.DB, table string, partition string) (err error) {
+	keyColumn := a.KeyColumn
+	if keyColumn == "" {
+		keyColumn = "id"
+	}
+	chunkSize := a.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = 1000
+	}
+	db = db.WithContext(ctx)
+	count, err := countPartitionRows(ctx, db, table, partition)
+	if err != nil || count == 0 {
+		return err
+	}
+	file, err := a.Writer.Open(ctx, table, partition)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, file.Abort())
+		}
+	}()
+
+	var (
+		lastKey  any
+		exported int64
+	)
+	for {
+		columns, chunk, err := exportChunk(db, table, partition, keyColumn, lastKey, chunkSize)
+		if err != nil {
+			return err
+		}
+		if len(chunk) == 0 {
+			break
+		}
+		keyIndex := slices.Index(columns, keyColumn)
+		if keyIndex < 0 {
+			return fmt.Errorf("archive table %s: key column %s not found", table, keyColumn)
+		}
+		if err := file.Write(columns, chunk); err != nil {
+			return err
+		}
+		exported += int64(len(chunk))
+		lastKey = chunk[len(chunk)-1][keyIndex]
+		if len(chunk) < chunkSize {
+			break
+		}
+	}
+	written, err := file.Commit()
+	if err != nil {
+		return err
+	}
+	// 校验
+	remaining, err := countPartitionRows(ctx, db, table, partition)
+	if err != nil {
+		return err
+	}
+	if written != exported || exported != remaining {
+		return fmt.Errorf("%w: partition %s has %d rows, exported %d rows, written %d rows",
+			ErrArchiveVerifyFailed, partition, remaining, exported, written)
+	}
+	return nil
+}
+
+// exportChunk 导出一批数据
+func exportChunk(db *gorm.DB, table string, partition string, keyColumn string, lastKey any, limit int) ([]string, [][]any, error) {
+	sql := fmt.Sprintf("SELECT * FROM %s PARTITION (%s)", table, partition)
+	var args []any
+	if lastKey != nil {
+		sql += fmt.Sprintf(" WHERE %s > ?", keyColumn)
+		args = append(args, lastKey)
+	}
+	sql += fmt.Sprintf(" ORDER BY %s LIMIT %d", keyColumn, limit)
+	rows, err := db.Raw(sql, args...).Rows()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+	var chunk [][]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		for i, value := range values {
+			values[i] = normalizeArchiveValue(value, columnTypes[i].DatabaseTypeName())
+		}
+		chunk = append(chunk, values)
+	}
+	return columns, chunk, rows.Err()
+}
+
+// normalizeArchiveValue 统一导出的值
+// 首批没有绑定参数，驱动使用文本协议返回[]byte；之后绑定了lastKey，使用二进制协议返回int64/float64等
+// 按列类型将[]byte转换为与二进制协议一致的类型，保证同一列在各批次中的输出一致
+func normalizeArchiveValue(value any, databaseType string) any {
+	b, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+	str := string(b)
+	databaseType = strings.ToUpper(databaseType)
+	unsigned := strings.HasPrefix(databaseType, "UNSIGNED ")
+	switch strings.TrimPrefix(databaseType, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if unsigned {
+			if v, err := strconv.ParseUint(str, 10, 64); err == nil {
+				if v <= math.MaxInt64 {
+					return int64(v)
+				}
+				return v
+			}
+		} else if v, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return v
+		}
+	case "FLOAT":
+		if v, err := strconv.ParseFloat(str, 32); err == nil {
+			return float32(v)
+		}
+	case "DOUBLE":
+		if v, err := strconv.ParseFloat(str, 64); err == nil {
+			return v
+		}
+	}
+	return str
+}
+
+type ArchiveFormat string // 导出文件格式
+
+const (
+	ArchiveFormatJSONL ArchiveFormat = "jsonl"
+	ArchiveFormatCSV   ArchiveFormat = "csv"
+)
+
+// ArchiveFileWriter 导出到gzip压缩的文件，文件名为 {table}_{partition}.{format}.gz
+// 先写入临时文件，提交时重新读取文件校验行数后再重命名
+type ArchiveFileWriter struct {
+	dir    string
+	format ArchiveFormat
+}
+
+// NewArchiveFileWriter 实例化文件导出，format支持jsonl/csv
+func NewArchiveFileWriter(dir string, format ArchiveFormat) *ArchiveFileWriter {
+	return &ArchiveFileWriter{dir: dir, format: format}
+}
+
+func (w *ArchiveFileWriter) Open(ctx context.Context, table string, partition string) (ArchiveFile, error) {
+	if w.format != ArchiveFormatJSONL && w.format != ArchiveFormatCSV {
+		return nil, fmt.Errorf("unsupported archive format %s", w.format)
+	}
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(w.dir, fmt.Sprintf("%s_%s.%s.gz", table, partition, w.format))
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &archiveFile{path: path, format: w.format, file: file, gz: gz, csv: csv.NewWriter(gz)}, nil
+}
+
+type archiveFile struct {
+	path   string
+	format ArchiveFormat
+	file   *os.File
+	gz     *gzip.Writer
+	csv    *csv.Writer
+	header bool // csv是否已写入表头
+}
+
+func (f *archiveFile) Write(columns []string, rows [][]any) error {
+	switch f.format {
+	case ArchiveFormatCSV:
+		if !f.header {
+			if err := f.csv.Write(columns); err != nil {
+				return err
+			}
+			f.header = true
+		}
+		record := make([]string, len(columns))
+		for _, row := range rows {
+			for i, value := range row {
+				record[i] = formatArchiveValue(value)
+			}
+			if err := f.csv.Write(record); err != nil {
+				return err
+			}
+		}
+		f.csv.Flush()
+		return f.csv.Error()
+	default:
+		for _, row := range rows {
+			record := make(map[string]any, len(columns))
+			for i, column := range columns {
+				record[column] = row[i]
+			}
+			b, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if _, err := f.gz.Write(append(b, '\n')); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (f *archiveFile) Commit() (int64, error) {
+	if err := f.gz.Close(); err != nil {
+		return 0, err
+	}
+	if err := f.file.Sync(); err != nil {
+		return 0, err
+	}
+	if err := f.file.Close(); err != nil {
+		return 0, err
+	}
+	rows, err := countArchiveFileRows(f.path+".tmp", f.format)
+	if err != nil {
+		return 0, err
+	}
+	return rows, os.Rename(f.path+".tmp", f.path)
+}
+
+func (f *archiveFile) Abort() error {
+	f.gz.Close()
+	f.file.Close()
+	return os.Remove(f.path + ".tmp")
+}
+
+// countArchiveFileRows 重新读取导出文件，统计行数
+func countArchiveFileRows(path string, format ArchiveFormat) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+	var rows int64
+	if format == ArchiveFormatCSV {
+		reader := csv.NewReader(gz)
+		for {
+			_, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			rows++
+		}
+		// 表头
+		return max(rows-1, 0), nil
+	}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		rows++
+	}
+	return rows, scanner.Err()
+}
+
+// formatArchiveValue csv字段值
+func formatArchiveValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return v.Format(time.DateTime)
+	default:
+		return fmt.Sprint(v)
+	}
+}
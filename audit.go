@@ -0,0 +1,542 @@
+package gormx
+
+// DML审计日志
+// 通过gorm插件记录所有的新增、更新、删除操作（表、主键、操作人、sql、影响行数、时间）
+// 审计记录通过队列异步批量写入sink，sink支持数据库表、JSONL文件、回调函数
+// 事务中的记录先缓存在事务中，提交后才写入队列，回滚则丢弃
+//
+// sink, err := gormx.NewAuditTableSink(db)
+// auditor := gormx.NewAuditor(gormx.AuditConfig{Sink: sink})
+// db.Use(auditor)
+// defer auditor.Close()
+//
+// // 在请求中指定操作人
+// ctx = gormx.ContextWithAuditActor(ctx, "user:1001")
+// db.WithContext(ctx).Delete(&user)
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/itmisx/logx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AuditRecord 审计记录
+type AuditRecord struct {
+	ID           int64  `json:"-" gorm:"column:id;type:bigint;primaryKey;autoIncrement;comment:主键"`
+	Action       string `json:"action" gorm:"column:action;type:varchar(10);index:idx_table_action,priority:2;comment:操作 create/update/delete"`
+	Table        string `json:"table" gorm:"column:table_name;type:varchar(100);index:idx_table_action,priority:1;comment:表名"`
+	PrimaryKeys  string `json:"primary_keys" gorm:"column:primary_keys;type:text;comment:主键值(json数组)"`
+	Actor        string `json:"actor" gorm:"column:actor;type:varchar(100);index;comment:操作人"`
+	Sql          string `json:"sql" gorm:"column:sql;type:text;comment:执行的sql"`
+	RowsAffected int64  `json:"rows_affected" gorm:"column:rows_affected;type:bigint;comment:影响行数"`
+	CreatedAt    int64  `json:"created_at" gorm:"column:created_at;type:bigint;index;comment:操作时间(毫秒)"`
+}
+
+func (AuditRecord) TableName() string {
+	return "gorm_audit_log"
+}
+
+// 审计操作
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+// AuditSink 审计记录的写入目标
+type AuditSink interface {
+	Write(ctx context.Context, records []AuditRecord) error
+}
+
+// AuditSinkFunc 回调函数形式的sink
+type AuditSinkFunc func(ctx context.Context, records []AuditRecord) error
+
+func (f AuditSinkFunc) Write(ctx context.Context, records []AuditRecord) error {
+	return f(ctx, records)
+}
+
+// AuditConfig 审计配置
+type AuditConfig struct {
+	Sink          AuditSink                        // 写入目标
+	Tables        []string                         // 仅审计这些表，为空则审计所有表
+	BatchSize     int                              // 批量写入条数，默认100
+	FlushInterval time.Duration                    // 最长写入间隔，默认1s
+	QueueSize     int                              // 队列长度，默认10000
+	Block         bool                             // 队列满时是否阻塞业务等待（背压），否则丢弃并计数
+	ActorFunc     func(ctx context.Context) string // 从context获取操作人，优先级低于ContextWithAuditActor
+}
+
+// Auditor 审计插件
+type Auditor struct {
+	cfg     AuditConfig
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan AuditRecord
+	done    chan struct{}
+	dropped atomic.Int64 // 因队列满而丢弃的条数
+}
+
+type auditActorKey struct{}
+
+// ContextWithAuditActor 指定调用链的操作人
+func ContextWithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// NewAuditor 实例化审计插件，并启动异步写入
+func NewAuditor(cfg AuditConfig) *Auditor {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	a := &Auditor{
+		cfg:   cfg,
+		queue: make(chan AuditRecord, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Name gorm插件名称
+func (a *Auditor) Name() string {
+	return "gormx:audit"
+}
+
+// Initialize 注册审计callback
+func (a *Auditor) Initialize(db *gorm.DB) error {
+	if a.cfg.Sink == nil {
+		return errors.New("audit sink is nil")
+	}
+	// 包装连接池，手动开启的事务(Begin/Transaction)提交后再写入审计记录
+	if preparedStmt, ok := db.ConnPool.(*gorm.PreparedStmtDB); ok {
+		preparedStmt.ConnPool = &auditConnPool{ConnPool: preparedStmt.ConnPool, auditor: a}
+	} else {
+		db.ConnPool = &auditConnPool{ConnPool: db.ConnPool, auditor: a}
+	}
+	db.Statement.ConnPool = db.ConnPool
+	callback := db.Callback()
+	if err := callback.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("gormx:audit", a.auditFunc(AuditActionCreate)); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("gormx:audit", a.auditFunc(AuditActionUpdate)); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("gormx:audit", a.auditFunc(AuditActionDelete)); err != nil {
+		return err
+	}
+	// 默认事务提交后写入审计记录
+	// 配置了dbresolver时，默认事务在dbresolver切换后的连接池上开启，无法通过包装连接池感知提交
+	if err := callback.Create().After("gorm:commit_or_rollback_transaction").Register("gormx:audit_commit", a.commitFunc); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gorm:commit_or_rollback_transaction").Register("gormx:audit_commit", a.commitFunc); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gorm:commit_or_rollback_transaction").Register("gormx:audit_commit", a.commitFunc); err != nil {
+		return err
+	}
+	// db.Exec 执行的原生dml
+	return callback.Raw().After("gorm:raw").Register("gormx:audit", a.auditFunc(""))
+}
+
+// Dropped 因队列满而丢弃的条数
+func (a *Auditor) Dropped() int64 {
+	return a.dropped.Load()
+}
+
+// Close 停止接收审计记录，并等待队列中的记录写入完成
+func (a *Auditor) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
+
+// auditFunc 审计callback，action为空时根据sql判断
+func (a *Auditor) auditFunc(action string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		if db.Error != nil || stmt.SQL.Len() == 0 {
+			return
+		}
+		sql := db.Dialector.Explain(stmt.SQL.String(), stmt.Vars...)
+		table, act := stmt.Table, action
+		if act == "" || table == "" {
+			fp := Fingerprint(sql)
+			if act == "" {
+				switch {
+				case strings.HasPrefix(fp, "insert"), strings.HasPrefix(fp, "replace"):
+					act = AuditActionCreate
+				case strings.HasPrefix(fp, "update"):
+					act = AuditActionUpdate
+				case strings.HasPrefix(fp, "delete"):
+					act = AuditActionDelete
+				default:
+					return
+				}
+			}
+			if table == "" {
+				table = fingerprintTable(fp)
+			}
+		}
+		if table == (AuditRecord{}).TableName() || !a.auditable(table) {
+			return
+		}
+		var primaryKeys string
+		if keys := auditPrimaryKeys(stmt); len(keys) > 0 {
+			if b, err := json.Marshal(keys); err == nil {
+				primaryKeys = string(b)
+			}
+		}
+		record := AuditRecord{
+			Action:       act,
+			Table:        table,
+			PrimaryKeys:  primaryKeys,
+			Actor:        a.actor(stmt.Context),
+			Sql:          removeEscapeCharacter(sql),
+			RowsAffected: db.RowsAffected,
+			CreatedAt:    time.Now().UnixMilli(),
+		}
+		// 默认事务中的记录等待commitFunc写入
+		if _, ok := db.InstanceGet("gorm:started_transaction"); ok {
+			value, _ := db.InstanceGet(auditRecordsKey)
+			records, _ := value.([]AuditRecord)
+			db.InstanceSet(auditRecordsKey, append(records, record))
+			return
+		}
+		// 手动开启的事务中的记录等待提交
+		if tx := auditTxOf(stmt.ConnPool); tx != nil {
+			tx.add(record)
+			return
+		}
+		a.push(record)
+	}
+}
+
+// 默认事务中缓存的审计记录
+const auditRecordsKey = "gormx:audit_records"
+
+// commitFunc 默认事务提交成功后写入审计记录，回滚则丢弃
+func (a *Auditor) commitFunc(db *gorm.DB) {
+	records, ok := db.InstanceGet(auditRecordsKey)
+	if !ok || db.Error != nil {
+		return
+	}
+	for _, record := range records.([]AuditRecord) {
+		a.push(record)
+	}
+}
+
+// auditable 是否审计该表
+func (a *Auditor) auditable(table string) bool {
+	if len(a.cfg.Tables) == 0 {
+		return true
+	}
+	for _, t := range a.cfg.Tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// actor 获取操作人
+func (a *Auditor) actor(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if actor, ok := ctx.Value(auditActorKey{}).(string); ok {
+		return actor
+	}
+	if a.cfg.ActorFunc != nil {
+		return a.cfg.ActorFunc(ctx)
+	}
+	return ""
+}
+
+// push 写入队列
+func (a *Auditor) push(record AuditRecord) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.dropped.Add(1)
+		return
+	}
+	if a.cfg.Block {
+		a.queue <- record
+		return
+	}
+	select {
+	case a.queue <- record:
+	default:
+		a.dropped.Add(1)
+	}
+}
+
+// auditConnPool 包装连接池，开启的事务为auditTx
+type auditConnPool struct {
+	gorm.ConnPool
+	auditor *Auditor
+}
+
+func (p *auditConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var (
+		tx  gorm.ConnPool
+		err error
+	)
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	case gorm.ConnPoolBeginner:
+		tx, err = beginner.BeginTx(ctx, opts)
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 无法包装的事务，审计记录直接写入队列
+	t, ok := tx.(gorm.Tx)
+	if !ok {
+		return tx, nil
+	}
+	sqlDB, _ := p.GetDBConn()
+	return &auditTx{Tx: t, db: sqlDB, auditor: p.auditor}, nil
+}
+
+// GetDBConn 获取底层的*sql.DB，供gorm.DB.DB()使用
+func (p *auditConnPool) GetDBConn() (*sql.DB, error) {
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	if connector, ok := p.ConnPool.(gorm.GetDBConnector); ok {
+		return connector.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// auditTx 缓存事务中的审计记录，提交成功后写入队列，回滚则丢弃
+type auditTx struct {
+	gorm.Tx
+	db      *sql.DB
+	auditor *Auditor
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+// auditTxOf 获取连接对应的auditTx，不在事务中时返回nil
+func auditTxOf(pool gorm.ConnPool) *auditTx {
+	if tx, ok := pool.(*gorm.PreparedStmtTX); ok {
+		pool = tx.Tx
+	}
+	tx, _ := pool.(*auditTx)
+	return tx
+}
+
+func (tx *auditTx) add(record AuditRecord) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	tx.records = append(tx.records, record)
+}
+
+// take 取出缓存的审计记录
+func (tx *auditTx) take() []AuditRecord {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	records := tx.records
+	tx.records = nil
+	return records
+}
+
+func (tx *auditTx) Commit() error {
+	if err := tx.Tx.Commit(); err != nil {
+		tx.take()
+		return err
+	}
+	for _, record := range tx.take() {
+		tx.auditor.push(record)
+	}
+	return nil
+}
+
+func (tx *auditTx) Rollback() error {
+	tx.take()
+	return tx.Tx.Rollback()
+}
+
+// GetDBConn 获取底层的*sql.DB，供gorm.DB.DB()使用
+func (tx *auditTx) GetDBConn() (*sql.DB, error) {
+	if tx.db == nil {
+		return nil, gorm.ErrInvalidDB
+	}
+	return tx.db, nil
+}
+
+// run 批量写入sink
+func (a *Auditor) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]AuditRecord, 0, a.cfg.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		if err := a.cfg.Sink.Write(ctx, batch); err != nil {
+			logx.Error(ctx, "write audit records failed", logx.Err(err), logx.Int("count", len(batch)))
+		}
+		batch = make([]AuditRecord, 0, a.cfg.BatchSize)
+	}
+	for {
+		select {
+		case record, ok := <-a.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= a.cfg.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// auditPrimaryKeys 获取操作记录的主键值
+// 优先从操作的对象中获取，获取不到时从where条件中获取
+func auditPrimaryKeys(stmt *gorm.Statement) (keys []interface{}) {
+	if stmt.Schema == nil || len(stmt.Schema.PrimaryFields) == 0 {
+		return nil
+	}
+	fields := stmt.Schema.PrimaryFields
+	collect := func(rv reflect.Value) {
+		if rv.Kind() != reflect.Struct {
+			return
+		}
+		values := make([]interface{}, 0, len(fields))
+		for _, field := range fields {
+			value, zero := field.ValueOf(stmt.Context, rv)
+			if zero {
+				return
+			}
+			values = append(values, value)
+		}
+		if len(values) == 1 {
+			keys = append(keys, values[0])
+		} else {
+			keys = append(keys, values)
+		}
+	}
+	if stmt.ReflectValue.IsValid() {
+		switch stmt.ReflectValue.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < stmt.ReflectValue.Len(); i++ {
+				collect(reflect.Indirect(stmt.ReflectValue.Index(i)))
+			}
+		case reflect.Struct:
+			collect(stmt.ReflectValue)
+		}
+	}
+	if len(keys) > 0 || len(fields) != 1 {
+		return keys
+	}
+	// 单主键时从where条件中获取
+	where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where)
+	if !ok {
+		return nil
+	}
+	isPrimary := func(column interface{}) bool {
+		switch c := column.(type) {
+		case string:
+			return c == fields[0].DBName
+		case clause.Column:
+			return c.Name == fields[0].DBName || c.Name == clause.PrimaryKey
+		}
+		return false
+	}
+	for _, expr := range where.Exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if isPrimary(e.Column) {
+				keys = append(keys, e.Value)
+			}
+		case clause.IN:
+			if isPrimary(e.Column) {
+				keys = append(keys, e.Values...)
+			}
+		}
+	}
+	return keys
+}
+
+// NewAuditTableSink 写入数据库表gorm_audit_log的sink，表不存在时自动创建
+func NewAuditTableSink(db *gorm.DB) (AuditSink, error) {
+	if err := db.Migrator().AutoMigrate(&AuditRecord{}); err != nil {
+		return nil, err
+	}
+	return AuditSinkFunc(func(ctx context.Context, records []AuditRecord) error {
+		return db.WithContext(ctx).Session(&gorm.Session{SkipHooks: true}).CreateInBatches(records, len(records)).Error
+	}), nil
+}
+
+// AuditFileSink 写入JSONL文件的sink
+type AuditFileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewAuditFileSink 实例化JSONL文件sink，追加写入
+func NewAuditFileSink(path string) (*AuditFileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditFileSink{file: file}, nil
+}
+
+func (s *AuditFileSink) Write(ctx context.Context, records []AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var buf []byte
+	for _, record := range records {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+	_, err := s.file.Write(buf)
+	return err
+}
+
+// Close 关闭文件
+func (s *AuditFileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
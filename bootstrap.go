@@ -0,0 +1,242 @@
+package gormx
+
+// 未分区表转换为按时间范围分区
+// 根据分区列的最小值、最大值及分区单位生成历史分区，主键不包含分区列时自动调整主键
+//
+// partition := gormx.NewPartition(db, database, "orders", gormx.PartitionUnitMonth, time.Hour*24*180)
+// err := partition.Bootstrap(ctx, gormx.PartitionBootstrapOptions{Column: "created_at"})
+//
+// 注意：表的唯一索引同样需要包含分区列，否则转换会失败
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 单表最多的分区数
+const maxPartitions = 8192
+
+// ErrTooManyPartitions 生成的分区数超过mysql限制
+var ErrTooManyPartitions = errors.New("too many partitions")
+
+// PartitionBootstrapOptions 分区转换参数
+type PartitionBootstrapOptions struct {
+	Column string // 分区列
+	Online bool   // 通过Migration在线迁移执行，model需匿名嵌入gormx.Migration以支持双写
+}
+
+// bootstrapInfo 转换前表的信息
+type bootstrapInfo struct {
+	dataType    string        // 分区列类型
+	primaryKeys []string      // 主键列
+	min         sql.NullInt64 // 整数分区列的最小值
+	max         sql.NullInt64 // 整数分区列的最大值
+	minTime     sql.NullTime  // 时间分区列的最小值
+	maxTime     sql.NullTime  // 时间分区列的最大值
+}
+
+// Bootstrap 将未分区的表转换为按时间范围分区，已分区的表直接返回
+func (p *Partition) Bootstrap(ctx context.Context, opts PartitionBootstrapOptions) error {
+	if opts.Column == "" {
+		return errors.New("partition column is required")
+	}
+	partitioned, err := p.partitioned(ctx)
+	if err != nil || partitioned {
+		return err
+	}
+	info, err := p.bootstrapInfo(ctx, opts.Column)
+	if err != nil {
+		return err
+	}
+	ddl, err := p.bootstrapSQL(opts.Column, info, p.now())
+	if err != nil {
+		return err
+	}
+	if opts.Online {
+		return NewMigration(p.db, p.table, nil, nil, nil, ddl).Start()
+	}
+	return p.db.WithContext(ctx).Exec(ddl).Error
+}
+
+// partitioned 表是否已分区
+func (p *Partition) partitioned(ctx context.Context) (bool, error) {
+	var count int64
+	err := p.db.WithContext(ctx).Table("information_schema.PARTITIONS").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("PARTITION_NAME IS NOT NULL").
+		Count(&count).
+		Error
+	return count > 0, err
+}
+
+// bootstrapInfo 获取分区列类型、主键及分区列的取值范围
+func (p *Partition) bootstrapInfo(ctx context.Context, column string) (info bootstrapInfo, err error) {
+	db := p.db.WithContext(ctx)
+	err = db.Table("information_schema.COLUMNS").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("COLUMN_NAME = ?", column).
+		Limit(1).
+		Pluck("DATA_TYPE", &info.dataType).
+		Error
+	if err != nil {
+		return info, err
+	}
+	if info.dataType == "" {
+		return info, fmt.Errorf("table %s column %s not found", p.table, column)
+	}
+	info.dataType = strings.ToLower(info.dataType)
+	err = db.Table("information_schema.KEY_COLUMN_USAGE").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("CONSTRAINT_NAME = ?", "PRIMARY").
+		Order("ORDINAL_POSITION").
+		Pluck("COLUMN_NAME", &info.primaryKeys).
+		Error
+	if err != nil {
+		return info, err
+	}
+	if !isTimeColumn(info.dataType) {
+		row := db.Raw(fmt.Sprintf("SELECT MIN(%s), MAX(%s) FROM %s", column, column, p.table)).Row()
+		err = row.Scan(&info.min, &info.max)
+		return info, err
+	}
+	// DATE/DATETIME不含时区，按分区边界的时区解析；TIMESTAMP使用时间戳，与会话时区无关
+	expr := "DATE_FORMAT(%s(%s), '%%Y-%%m-%%d %%H:%%i:%%s')"
+	if info.dataType == "timestamp" {
+		expr = "FLOOR(UNIX_TIMESTAMP(%s(%s)))"
+	}
+	var minValue, maxValue sql.NullString
+	row := db.Raw(fmt.Sprintf("SELECT "+expr+", "+expr+" FROM %s", "MIN", column, "MAX", column, p.table)).Row()
+	if err = row.Scan(&minValue, &maxValue); err != nil {
+		return info, err
+	}
+	if info.minTime, err = p.parseBootstrapTime(info.dataType, minValue); err != nil {
+		return info, err
+	}
+	info.maxTime, err = p.parseBootstrapTime(info.dataType, maxValue)
+	return info, err
+}
+
+// parseBootstrapTime 解析时间分区列的取值
+func (p *Partition) parseBootstrapTime(dataType string, value sql.NullString) (sql.NullTime, error) {
+	if !value.Valid {
+		return sql.NullTime{}, nil
+	}
+	if dataType == "timestamp" {
+		sec, err := strconv.ParseInt(value.String, 10, 64)
+		if err != nil {
+			return sql.NullTime{}, err
+		}
+		return sql.NullTime{Time: time.Unix(sec, 0).In(p.loc()), Valid: true}, nil
+	}
+	t, err := time.ParseInLocation(time.DateTime, value.String, p.loc())
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// isTimeColumn 是否为时间类型的列
+func isTimeColumn(dataType string) bool {
+	return dataType == "date" || dataType == "datetime" || dataType == "timestamp"
+}
+
+// bootstrapKeyType 根据列类型确定分区键类型，已指定时使用指定的类型
+func (p *Partition) bootstrapKeyType(dataType string) PartitionKeyT {
+	if p.keyType != PartitionKeyAuto {
+		return p.keyType
+	}
+	if dataType == "date" || dataType == "datetime" {
+		return PartitionKeyColumns
+	}
+	return PartitionKeyUnixTimestamp
+}
+
+// bootstrapBounds 生成覆盖分区列取值范围及预创建范围的分区上界
+func (p *Partition) bootstrapBounds(info bootstrapInfo, now time.Time) ([]time.Time, error) {
+	// 分区列的最小值、最大值是否小于分区上界，值为NULL时为nil
+	var minBefore, maxBefore func(bound time.Time) bool
+	if isTimeColumn(info.dataType) {
+		if info.minTime.Valid {
+			minBefore = info.minTime.Time.Before
+		}
+		if info.maxTime.Valid {
+			maxBefore = info.maxTime.Time.Before
+		}
+	} else {
+		encoding := p.keyEncoding
+		if encoding == nil {
+			encoding = KeyEncodingSeconds
+		}
+		if info.min.Valid {
+			minBefore = func(bound time.Time) bool { return info.min.Int64 < encoding(bound) }
+		}
+		if info.max.Valid {
+			maxBefore = func(bound time.Time) bool { return info.max.Int64 < encoding(bound) }
+		}
+	}
+	first := p.periodStart(now, 1)
+	if minBefore != nil {
+		// 向前查找包含最小值的分区
+		for minBefore(p.periodStart(first, -1)) {
+			first = p.periodStart(first, -1)
+			if first.Before(p.periodStart(now, -maxPartitions)) {
+				return nil, fmt.Errorf("%w: min value of table %s", ErrTooManyPartitions, p.table)
+			}
+		}
+	}
+	last := p.periodStart(now, p.horizon+1)
+	var bounds []time.Time
+	for bound := first; ; bound = p.periodStart(bound, 1) {
+		bounds = append(bounds, bound)
+		if len(bounds) > maxPartitions {
+			return nil, fmt.Errorf("%w: table %s", ErrTooManyPartitions, p.table)
+		}
+		// 覆盖到预创建范围及分区列的最大值
+		if !bound.Before(last) && (maxBefore == nil || maxBefore(bound)) {
+			break
+		}
+	}
+	return bounds, nil
+}
+
+// bootstrapSQL 生成转换为分区表的ddl
+func (p *Partition) bootstrapSQL(column string, info bootstrapInfo, now time.Time) (string, error) {
+	keyType := p.bootstrapKeyType(info.dataType)
+	if err := p.validateUnit(keyType, info.dataType); err != nil {
+		return "", err
+	}
+	bounds, err := p.bootstrapBounds(info, now)
+	if err != nil {
+		return "", err
+	}
+	var method string
+	switch {
+	case keyType == PartitionKeyColumns:
+		method = fmt.Sprintf("RANGE COLUMNS(%s)", column)
+	case keyType == PartitionKeyToDays:
+		method = fmt.Sprintf("RANGE (TO_DAYS(%s))", column)
+	case info.dataType == "timestamp":
+		method = fmt.Sprintf("RANGE (UNIX_TIMESTAMP(%s))", column)
+	default:
+		method = fmt.Sprintf("RANGE (%s)", column)
+	}
+	definitions := make([]string, 0, len(bounds))
+	for _, bound := range bounds {
+		definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN (%s)", p.partitionName(bound), p.rangeValue(keyType, bound)))
+	}
+	ddl := "ALTER TABLE " + p.table
+	// 主键需包含分区列
+	if len(info.primaryKeys) > 0 && !slices.Contains(info.primaryKeys, column) {
+		ddl += fmt.Sprintf(" DROP PRIMARY KEY, ADD PRIMARY KEY (%s)", strings.Join(append(slices.Clone(info.primaryKeys), column), ", "))
+	}
+	return fmt.Sprintf("%s PARTITION BY %s (%s)", ddl, method, strings.Join(definitions, ", ")), nil
+}
@@ -0,0 +1,247 @@
+package gormx
+
+// 请求级别的查询预算
+// 限制单个请求的sql执行次数、累计耗时、累计行数，超出后告警，开启Enforce时后续语句直接返回错误
+// Enforce模式下执行次数在执行前检查，达到MaxQueries后不再执行；耗时和行数在执行后才能统计
+//
+// // 中间件
+// ctx, budget := gormx.ContextWithQueryBudget(ctx, gormx.QueryBudget{MaxQueries: 100, MaxDuration: time.Second})
+// next(ctx)
+// summary := budget.Summary()
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/itmisx/logx"
+	"gorm.io/gorm"
+)
+
+// ErrQueryBudgetExceeded 超出查询预算，可通过errors.Is判断
+var ErrQueryBudgetExceeded = errors.New("query budget exceeded")
+
+// QueryBudget 查询预算，为0的项不限制
+type QueryBudget struct {
+	MaxQueries  int           // 最大执行次数
+	MaxDuration time.Duration // 最大累计耗时
+	MaxRows     int64         // 最大累计行数(查询返回行数和写入影响行数)
+	Enforce     bool          // 超出后后续语句返回错误，否则仅告警
+}
+
+// QueryBudgetSummary 查询预算的使用情况
+type QueryBudgetSummary struct {
+	Queries  int           // 执行次数
+	Duration time.Duration // 累计耗时
+	Rows     int64         // 累计行数
+	Exceeded string        // 超出的项 queries/duration/rows，未超出为空
+	Rejected int           // 超出后被拒绝执行的语句数
+}
+
+// QueryBudgetExceededError 超出查询预算的错误
+type QueryBudgetExceededError struct {
+	Budget  QueryBudget
+	Summary QueryBudgetSummary
+}
+
+func (e *QueryBudgetExceededError) Error() string {
+	switch e.Summary.Exceeded {
+	case "queries":
+		return fmt.Sprintf("%v: queries %d > %d", ErrQueryBudgetExceeded, e.Summary.Queries+e.Summary.Rejected, e.Budget.MaxQueries)
+	case "duration":
+		return fmt.Sprintf("%v: duration %v > %v", ErrQueryBudgetExceeded, e.Summary.Duration, e.Budget.MaxDuration)
+	default:
+		return fmt.Sprintf("%v: rows %d > %d", ErrQueryBudgetExceeded, e.Summary.Rows, e.Budget.MaxRows)
+	}
+}
+
+func (e *QueryBudgetExceededError) Is(target error) bool {
+	return target == ErrQueryBudgetExceeded
+}
+
+// QueryBudgetTracker 请求的查询预算跟踪
+type QueryBudgetTracker struct {
+	budget  QueryBudget
+	mu      sync.Mutex
+	summary QueryBudgetSummary
+}
+
+type queryBudgetKey struct{}
+
+// gormx内部执行的语句(如慢sql的EXPLAIN)通过InstanceSet标记，不计入查询预算
+const internalStatementKey = "gormx:internal"
+
+// ContextWithQueryBudget 为调用链设置查询预算
+func ContextWithQueryBudget(ctx context.Context, budget QueryBudget) (context.Context, *QueryBudgetTracker) {
+	tracker := &QueryBudgetTracker{budget: budget}
+	return context.WithValue(ctx, queryBudgetKey{}, tracker), tracker
+}
+
+// QueryBudgetFromContext 获取context中的查询预算
+func QueryBudgetFromContext(ctx context.Context) *QueryBudgetTracker {
+	if ctx == nil {
+		return nil
+	}
+	tracker, _ := ctx.Value(queryBudgetKey{}).(*QueryBudgetTracker)
+	return tracker
+}
+
+// Summary 获取查询预算的使用情况
+func (t *QueryBudgetTracker) Summary() QueryBudgetSummary {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.summary
+}
+
+// Err 超出预算时返回*QueryBudgetExceededError
+func (t *QueryBudgetTracker) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.summary.Exceeded == "" {
+		return nil
+	}
+	return &QueryBudgetExceededError{Budget: t.budget, Summary: t.summary}
+}
+
+// check 执行前检查，Enforce模式下超出预算或执行次数已达上限则拒绝执行，首次超出预算时返回true
+func (t *QueryBudgetTracker) check() (QueryBudgetSummary, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.budget.Enforce {
+		return t.summary, false, nil
+	}
+	var exceeded bool
+	if t.summary.Exceeded == "" {
+		if t.budget.MaxQueries <= 0 || t.summary.Queries < t.budget.MaxQueries {
+			return t.summary, false, nil
+		}
+		t.summary.Exceeded = "queries"
+		exceeded = true
+	}
+	t.summary.Rejected++
+	return t.summary, exceeded, &QueryBudgetExceededError{Budget: t.budget, Summary: t.summary}
+}
+
+// record 执行后记录，首次超出预算时返回true
+func (t *QueryBudgetTracker) record(elapsed time.Duration, rows int64) (QueryBudgetSummary, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.summary.Queries++
+	t.summary.Duration += elapsed
+	if rows > 0 {
+		t.summary.Rows += rows
+	}
+	if t.summary.Exceeded != "" {
+		return t.summary, false
+	}
+	switch {
+	case t.budget.MaxQueries > 0 && t.summary.Queries > t.budget.MaxQueries:
+		t.summary.Exceeded = "queries"
+	case t.budget.MaxDuration > 0 && t.summary.Duration > t.budget.MaxDuration:
+		t.summary.Exceeded = "duration"
+	case t.budget.MaxRows > 0 && t.summary.Rows > t.budget.MaxRows:
+		t.summary.Exceeded = "rows"
+	default:
+		return t.summary, false
+	}
+	return t.summary, true
+}
+
+// registerBudgetCallbacks 注册查询预算callback，执行前检查，执行后记录
+func registerBudgetCallbacks(db *gorm.DB) error {
+	type processor interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+	callback := db.Callback()
+	checks := []processor{
+		callback.Create().Before("gorm:create"),
+		callback.Query().Before("gorm:query"),
+		callback.Update().Before("gorm:update"),
+		callback.Delete().Before("gorm:delete"),
+		callback.Row().Before("gorm:row"),
+		callback.Raw().Before("gorm:raw"),
+	}
+	records := []processor{
+		callback.Create().After("gorm:create"),
+		callback.Query().After("gorm:query"),
+		callback.Update().After("gorm:update"),
+		callback.Delete().After("gorm:delete"),
+		callback.Row().After("gorm:row"),
+		callback.Raw().After("gorm:raw"),
+	}
+	for i := range checks {
+		if err := checks[i].Register("gormx:budget_check", checkQueryBudget); err != nil {
+			return err
+		}
+		if err := records[i].Register("gormx:budget_record", recordQueryBudget); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkQueryBudget 执行前检查查询预算
+func checkQueryBudget(db *gorm.DB) {
+	tracker := QueryBudgetFromContext(db.Statement.Context)
+	if tracker == nil || db.Error != nil {
+		return
+	}
+	if _, ok := db.InstanceGet(internalStatementKey); ok {
+		return
+	}
+	summary, exceeded, err := tracker.check()
+	if exceeded {
+		warnQueryBudgetExceeded(db, summary)
+	}
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet("gormx:budget_begin", time.Now())
+}
+
+// recordQueryBudget 执行后记录查询预算的使用情况
+func recordQueryBudget(db *gorm.DB) {
+	tracker := QueryBudgetFromContext(db.Statement.Context)
+	if tracker == nil {
+		return
+	}
+	begin, ok := db.InstanceGet("gormx:budget_begin")
+	if !ok {
+		return
+	}
+	summary, exceeded := tracker.record(time.Since(begin.(time.Time)), db.RowsAffected)
+	if exceeded {
+		warnQueryBudgetExceeded(db, summary)
+	}
+}
+
+// warnQueryBudgetExceeded 首次超出预算时告警
+// 使用gormx日志记录器时按其输出模式和调用栈跳过规则输出
+func warnQueryBudgetExceeded(db *gorm.DB, summary QueryBudgetSummary) {
+	if l, ok := db.Logger.(*mylogger); ok {
+		l.warnQueryBudgetExceeded(db.Statement.Context, summary)
+		return
+	}
+	mylogger{mode: LoggerModeStructured}.warnQueryBudgetExceeded(db.Statement.Context, summary)
+}
+
+// warnQueryBudgetExceeded 输出查询预算超出告警
+func (l mylogger) warnQueryBudgetExceeded(ctx context.Context, summary QueryBudgetSummary) {
+	duration := float64(summary.Duration.Nanoseconds()) / 1e6
+	if l.console() {
+		l.Printf(l.warnStr+"QUERY BUDGET EXCEEDED %s: queries=%d rejected=%d duration=%.3fms rows=%d",
+			l.caller(), summary.Exceeded, summary.Queries, summary.Rejected, duration, summary.Rows)
+		return
+	}
+	logx.Warn(ctx,
+		"sql query budget exceeded",
+		logx.String("line", l.caller()),
+		logx.String("exceeded", summary.Exceeded),
+		logx.Int("queries", summary.Queries),
+		logx.Int("rejected", summary.Rejected),
+		logx.Float64("duration[ms]", duration),
+		logx.Int64("rows", summary.Rows))
+}
@@ -0,0 +1,120 @@
+package gormx
+
+import (
+	"context"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// 语句追踪信息
+// 通过callback写入statement的context，gorm执行完成后会将该context传给日志记录器的Trace
+type stmtTrace struct {
+	Table string // 操作的表
+	Node  string // 执行节点地址
+}
+
+type stmtTraceKey struct{}
+
+// dbresolver 开启TraceResolverMode后写入context的key
+const resolverModeKey = dbresolver.ResolverModeKey("dbresolver:resolver_mode_key")
+
+// nodeResolver 连接池与节点地址的映射
+type nodeResolver struct {
+	mu     sync.RWMutex
+	nodes  map[gorm.ConnPool]string
+	source string // 主库地址，事务等无法识别的连接池均在主库执行
+}
+
+func newNodeResolver(source string) *nodeResolver {
+	return &nodeResolver{
+		nodes:  make(map[gorm.ConnPool]string),
+		source: source,
+	}
+}
+
+// add 添加连接池与节点地址的映射
+func (r *nodeResolver) add(pool gorm.ConnPool, node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes[pool] = node
+}
+
+// node 获取连接池对应的节点地址
+func (r *nodeResolver) node(pool gorm.ConnPool) string {
+	if r == nil {
+		return ""
+	}
+	if prepared, ok := pool.(*gorm.PreparedStmtDB); ok {
+		pool = prepared.ConnPool
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if node, ok := r.nodes[pool]; ok {
+		return node
+	}
+	return r.source
+}
+
+// registerTraceCallbacks 注册语句追踪callback，在dbresolver选择连接池之后执行
+func registerTraceCallbacks(db *gorm.DB, nodes *nodeResolver) error {
+	callback := db.Callback()
+	processors := []interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}{
+		callback.Create().After("gorm:db_resolver"),
+		callback.Query().After("gorm:db_resolver"),
+		callback.Update().After("gorm:db_resolver"),
+		callback.Delete().After("gorm:db_resolver"),
+		callback.Row().After("gorm:db_resolver"),
+		callback.Raw().After("gorm:db_resolver"),
+	}
+	for _, processor := range processors {
+		if err := processor.Register("gormx:trace", traceStatement(nodes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// traceStatement 记录语句的追踪信息
+func traceStatement(nodes *nodeResolver) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		if stmt.Context == nil {
+			stmt.Context = context.Background()
+		}
+		stmt.Context = context.WithValue(stmt.Context, stmtTraceKey{}, &stmtTrace{
+			Table: stmt.Table,
+			Node:  nodes.node(stmt.ConnPool),
+		})
+	}
+}
+
+// getStmtTrace 获取语句的追踪信息
+func getStmtTrace(ctx context.Context) *stmtTrace {
+	if ctx == nil {
+		return nil
+	}
+	trace, _ := ctx.Value(stmtTraceKey{}).(*stmtTrace)
+	return trace
+}
+
+// getStmtNode 获取语句的执行节点地址
+func getStmtNode(ctx context.Context) string {
+	if trace := getStmtTrace(ctx); trace != nil {
+		return trace.Node
+	}
+	return ""
+}
+
+// getResolverMode 获取语句的执行目标 source/replica
+func getResolverMode(ctx context.Context) string {
+	if ctx != nil {
+		if mode, ok := ctx.Value(resolverModeKey).(dbresolver.ResolverMode); ok {
+			return string(mode)
+		}
+	}
+	return string(dbresolver.ResolverModeSource)
+}
@@ -0,0 +1,82 @@
+package gormx
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// 调用位置定位
+// 跳过gorm、gormx以及配置的包装层（如业务的repository封装）的调用栈，定位到真正的业务调用位置
+
+// gormx的包路径
+var gormxPackage = reflect.TypeOf(mylogger{}).PkgPath()
+
+// 默认跳过的包前缀
+var defaultCallerSkipPackages = []string{
+	"gorm.io/",
+	gormxPackage + ".",
+	"runtime.",
+	"reflect.",
+	"database/sql.",
+}
+
+// skipFrame 是否跳过该调用栈
+func skipFrame(frame runtime.Frame, skipPackages []string) bool {
+	// 测试文件中的调用不跳过
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	if strings.HasSuffix(frame.File, ".gen.go") {
+		return true
+	}
+	for _, prefix := range defaultCallerSkipPackages {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range skipPackages {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerFrames 获取跳过后的调用栈，最多depth层
+func callerFrames(skipPackages []string, depth int) []runtime.Frame {
+	pcs := [64]uintptr{}
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	var result []runtime.Frame
+	for len(result) < depth {
+		frame, more := frames.Next()
+		if frame.PC != 0 && !skipFrame(frame, skipPackages) {
+			result = append(result, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	return result
+}
+
+// fileWithLineNum 获取业务调用位置 file:line
+func fileWithLineNum(skipPackages []string) string {
+	frames := callerFrames(skipPackages, 1)
+	if len(frames) == 0 {
+		return ""
+	}
+	return frames[0].File + ":" + strconv.Itoa(frames[0].Line)
+}
+
+// shortStack 获取业务调用栈 function file:line
+func shortStack(skipPackages []string, depth int) []string {
+	frames := callerFrames(skipPackages, depth)
+	stack := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		stack = append(stack, frame.Function+" "+frame.File+":"+strconv.Itoa(frame.Line))
+	}
+	return stack
+}
@@ -0,0 +1,46 @@
+package gormx
+
+import (
+	"context"
+	"time"
+
+	logger "gorm.io/gorm/logger"
+)
+
+// 通过context覆盖单个调用链的日志级别和慢sql阈值，不影响全局配置
+//
+// 如对带有X-Debug头的请求打印完整sql
+// ctx = gormx.ContextWithLogLevel(ctx, logger.Info)
+// db.WithContext(ctx).Find(&users)
+
+type logLevelKey struct{}
+
+type slowThresholdKey struct{}
+
+// ContextWithLogLevel 覆盖调用链的日志级别
+func ContextWithLogLevel(ctx context.Context, level logger.LogLevel) context.Context {
+	return context.WithValue(ctx, logLevelKey{}, level)
+}
+
+// ContextWithSlowThreshold 覆盖调用链的慢sql阈值，为0时不记录慢sql
+func ContextWithSlowThreshold(ctx context.Context, threshold time.Duration) context.Context {
+	return context.WithValue(ctx, slowThresholdKey{}, threshold)
+}
+
+// LogLevelFromContext 获取context中覆盖的日志级别
+func LogLevelFromContext(ctx context.Context) (logger.LogLevel, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	level, ok := ctx.Value(logLevelKey{}).(logger.LogLevel)
+	return level, ok
+}
+
+// SlowThresholdFromContext 获取context中覆盖的慢sql阈值
+func SlowThresholdFromContext(ctx context.Context) (time.Duration, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	threshold, ok := ctx.Value(slowThresholdKey{}).(time.Duration)
+	return threshold, ok
+}
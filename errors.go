@@ -0,0 +1,185 @@
+package gormx
+
+// mysql错误分类
+// 根据mysql.MySQLError的错误码将错误归类，避免业务通过字符串匹配判断错误类型
+//
+// if gormx.IsDuplicateKey(err) { ... }
+// if errors.Is(gormx.TranslateError(err), gormx.ErrDeadlock) { ... }
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// 错误分类
+var (
+	ErrDuplicateKey       = errors.New("duplicate key")              // 唯一键冲突 1062 1586
+	ErrDeadlock           = errors.New("deadlock")                   // 死锁 1213
+	ErrLockWaitTimeout    = errors.New("lock wait timeout")          // 锁等待超时 1205
+	ErrConnectionLost     = errors.New("connection lost")            // 连接断开 2006 2013 1053
+	ErrReadOnly           = errors.New("read only")                  // 只读实例 1290 1792 1836
+	ErrForeignKey         = errors.New("foreign key constraint")     // 外键约束 1451 1452
+	ErrDataTooLong        = errors.New("data too long")              // 数据超长 1406
+	ErrQueryTimeout       = errors.New("query timeout")              // 查询超时或被中断 3024 1317
+	ErrTableNotExists     = errors.New("table not exists")           // 表不存在 1146
+	ErrTooManyConnections = errors.New("too many connections")       // 连接数超限 1040
+	ErrAccessDenied       = errors.New("access denied")              // 权限不足 1044 1045 1142
+	ErrLockNotAcquired    = errors.New("lock could not be acquired") // NOWAIT获取锁失败 3572
+)
+
+// mysql错误码与错误分类的映射
+var mysqlErrorClasses = map[uint16]error{
+	1062: ErrDuplicateKey,
+	1586: ErrDuplicateKey,
+	1213: ErrDeadlock,
+	1205: ErrLockWaitTimeout,
+	2006: ErrConnectionLost,
+	2013: ErrConnectionLost,
+	1053: ErrConnectionLost,
+	1290: ErrReadOnly,
+	1792: ErrReadOnly,
+	1836: ErrReadOnly,
+	1451: ErrForeignKey,
+	1452: ErrForeignKey,
+	1406: ErrDataTooLong,
+	3024: ErrQueryTimeout,
+	1317: ErrQueryTimeout,
+	1146: ErrTableNotExists,
+	1040: ErrTooManyConnections,
+	1044: ErrAccessDenied,
+	1045: ErrAccessDenied,
+	1142: ErrAccessDenied,
+	3572: ErrLockNotAcquired,
+}
+
+// 错误分类名称，用于日志
+var errorClassNames = map[error]string{
+	ErrDuplicateKey:       "duplicate_key",
+	ErrDeadlock:           "deadlock",
+	ErrLockWaitTimeout:    "lock_wait_timeout",
+	ErrConnectionLost:     "connection_lost",
+	ErrReadOnly:           "read_only",
+	ErrForeignKey:         "foreign_key",
+	ErrDataTooLong:        "data_too_long",
+	ErrQueryTimeout:       "query_timeout",
+	ErrTableNotExists:     "table_not_exists",
+	ErrTooManyConnections: "too_many_connections",
+	ErrAccessDenied:       "access_denied",
+	ErrLockNotAcquired:    "lock_not_acquired",
+}
+
+// ClassifiedError 已分类的错误，errors.Is可匹配分类，errors.As可获取原始错误
+type ClassifiedError struct {
+	Class error // 错误分类
+	Err   error // 原始错误
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ClassifiedError) Is(target error) bool {
+	return e.Class == target
+}
+
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// ClassifyError 获取错误的分类，无法分类时返回nil
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErrorClasses[mysqlErr.Number]
+	}
+	switch {
+	// 开启gorm的TranslateError后的错误
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicateKey
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return ErrForeignKey
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn):
+		return ErrConnectionLost
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrQueryTimeout
+	}
+	return nil
+}
+
+// TranslateError 将错误包装为ClassifiedError，无法分类时原样返回
+func TranslateError(err error) error {
+	class := ClassifyError(err)
+	if class == nil {
+		return err
+	}
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return err
+	}
+	return &ClassifiedError{Class: class, Err: err}
+}
+
+// ErrorClass 获取错误分类名称，无法分类时返回空
+func ErrorClass(err error) string {
+	return errorClassNames[ClassifyError(err)]
+}
+
+// MySQLErrorNumber 获取mysql错误码，非mysql错误返回0
+func MySQLErrorNumber(err error) uint16 {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number
+	}
+	return 0
+}
+
+// IsDuplicateKey 是否唯一键冲突
+func IsDuplicateKey(err error) bool {
+	return ClassifyError(err) == ErrDuplicateKey
+}
+
+// IsDeadlock 是否死锁
+func IsDeadlock(err error) bool {
+	return ClassifyError(err) == ErrDeadlock
+}
+
+// IsLockWaitTimeout 是否锁等待超时
+func IsLockWaitTimeout(err error) bool {
+	return ClassifyError(err) == ErrLockWaitTimeout
+}
+
+// IsConnectionLost 是否连接断开
+func IsConnectionLost(err error) bool {
+	return ClassifyError(err) == ErrConnectionLost
+}
+
+// IsReadOnly 是否只读实例
+func IsReadOnly(err error) bool {
+	return ClassifyError(err) == ErrReadOnly
+}
+
+// IsForeignKey 是否外键约束
+func IsForeignKey(err error) bool {
+	return ClassifyError(err) == ErrForeignKey
+}
+
+// IsQueryTimeout 是否查询超时或被中断
+func IsQueryTimeout(err error) bool {
+	return ClassifyError(err) == ErrQueryTimeout
+}
+
+// IsTableNotExists 是否表不存在
+func IsTableNotExists(err error) bool {
+	return ClassifyError(err) == ErrTableNotExists
+}
@@ -0,0 +1,94 @@
+package gormx
+
+// 慢sql自动执行 EXPLAIN FORMAT=JSON 获取执行计划
+// 仅针对select语句，优先在从库执行，同一sql指纹在DefaultExplainInterval内只执行一次
+// 执行计划异步获取，获取后输出日志并回调 Config.SlowSqlExplainHandler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	logger "gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+var (
+	// 同一sql指纹两次EXPLAIN的最小间隔
+	DefaultExplainInterval = time.Minute
+	// EXPLAIN执行超时时间
+	DefaultExplainTimeout = time.Second * 5
+)
+
+type sqlExplainer struct {
+	mu      sync.Mutex
+	db      *gorm.DB             // 执行EXPLAIN的连接，New之后设置
+	last    map[string]time.Time // 指纹最近一次EXPLAIN的时间
+	running chan struct{}        // 同一时间只执行一个EXPLAIN
+}
+
+func newSqlExplainer() *sqlExplainer {
+	return &sqlExplainer{
+		last:    make(map[string]time.Time),
+		running: make(chan struct{}, 1),
+	}
+}
+
+// setDB 设置执行EXPLAIN的连接
+func (e *sqlExplainer) setDB(db *gorm.DB) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.db = db.Session(&gorm.Session{NewDB: true, Logger: logger.Discard})
+}
+
+// acquire 判断是否可以执行EXPLAIN，可以则占用执行权，执行完需调用release
+func (e *sqlExplainer) acquire(sql string) bool {
+	fp := Fingerprint(sql)
+	if !strings.HasPrefix(fp, "select") {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.db == nil {
+		return false
+	}
+	if last, ok := e.last[fp]; ok && time.Since(last) < DefaultExplainInterval {
+		return false
+	}
+	select {
+	case e.running <- struct{}{}:
+	default:
+		return false
+	}
+	// 清理过期的记录，避免无限增长
+	for k, v := range e.last {
+		if time.Since(v) >= DefaultExplainInterval {
+			delete(e.last, k)
+		}
+	}
+	e.last[fp] = time.Now()
+	return true
+}
+
+func (e *sqlExplainer) release() {
+	<-e.running
+}
+
+// explain 在从库执行 EXPLAIN FORMAT=JSON
+func (e *sqlExplainer) explain(ctx context.Context, sql string) (plan string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultExplainTimeout)
+	defer cancel()
+	e.mu.Lock()
+	db := e.db
+	e.mu.Unlock()
+	// 内部语句，不计入请求的查询预算
+	err = db.WithContext(ctx).
+		InstanceSet(internalStatementKey, true).
+		Clauses(dbresolver.Read).
+		Raw("EXPLAIN FORMAT=JSON " + trimResolverMode(sql)).
+		Row().
+		Scan(&plan)
+	return removeEscapeCharacter(plan), err
+}
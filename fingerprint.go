@@ -0,0 +1,152 @@
+package gormx
+
+import (
+	"regexp"
+	"strings"
+)
+
+// sql指纹
+// 将sql中的字面量（字符串、数字）替换为?，合并IN列表和VALUES列表，去除注释和多余的空白
+// 使得仅参数不同的sql得到相同的指纹，用于聚合统计
+//
+// SELECT * FROM `user` WHERE id IN (1,2,3) AND name = 'tom'
+// =>
+// select * from `user` where id in (?+) and name = ?
+
+var (
+	// in (?, ?, ?) => in (?+)
+	fingerprintInReg = regexp.MustCompile(`\bin ?\( ?\?(?: ?, ?\?)* ?\)`)
+	// values (?, ?), (?, ?) => values (?+)
+	fingerprintValuesReg = regexp.MustCompile(`\bvalues ?\( ?\?(?: ?, ?\?)* ?\)(?: ?, ?\( ?\?(?: ?, ?\?)* ?\))*`)
+	// 语句操作的表
+	fingerprintTableReg = regexp.MustCompile("\\b(?:from|into|update|join|table) (`[^`]+`(?:\\.`[^`]+`)?|[\\w$.]+)")
+)
+
+// Fingerprint 获取sql指纹
+func Fingerprint(sql string) string {
+	sql = strings.TrimSpace(trimResolverMode(sql))
+	var (
+		b         strings.Builder
+		n         = len(sql)
+		lastSpace = true // 上一个输出的字符是否为空白，用于合并空白
+	)
+	b.Grow(n)
+	writeSpace := func() {
+		if !lastSpace {
+			b.WriteByte(' ')
+			lastSpace = true
+		}
+	}
+	for i := 0; i < n; i++ {
+		c := sql[i]
+		switch {
+		// 字符串字面量
+		case c == '\'' || c == '"':
+			j := i + 1
+			for ; j < n; j++ {
+				if sql[j] == '\\' {
+					j++
+					continue
+				}
+				if sql[j] == c {
+					// 连续两个引号为转义
+					if j+1 < n && sql[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte('?')
+			lastSpace = false
+			i = j
+		// 反引号标识符原样保留
+		case c == '`':
+			end := n
+			if j := strings.IndexByte(sql[i+1:], '`'); j >= 0 {
+				end = i + j + 2
+			}
+			b.WriteString(sql[i:end])
+			lastSpace = false
+			i = end - 1
+		// 单行注释
+		case c == '#' || (c == '-' && i+1 < n && sql[i+1] == '-'):
+			j := strings.IndexByte(sql[i:], '\n')
+			if j < 0 {
+				j = n - i
+			}
+			writeSpace()
+			i += j
+		// 多行注释
+		case c == '/' && i+1 < n && sql[i+1] == '*':
+			j := strings.Index(sql[i+2:], "*/")
+			if j < 0 {
+				j = n - i - 2
+			}
+			writeSpace()
+			i += j + 3
+		// 空白
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			writeSpace()
+		// 数字字面量，跟在标识符后面的数字（如t1,p20250101）不处理
+		case isDigit(c) && (i == 0 || !isIdentChar(sql[i-1])):
+			j := i + 1
+			for j < n && (isIdentChar(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			b.WriteByte('?')
+			lastSpace = false
+			i = j - 1
+		default:
+			// 标识符中的数字原样保留
+			if isIdentChar(c) {
+				for i < n && isIdentChar(sql[i]) {
+					b.WriteByte(toLower(sql[i]))
+					i++
+				}
+				i--
+			} else {
+				b.WriteByte(c)
+			}
+			lastSpace = false
+		}
+	}
+	fp := strings.TrimSpace(b.String())
+	fp = fingerprintInReg.ReplaceAllString(fp, "in (?+)")
+	fp = fingerprintValuesReg.ReplaceAllString(fp, "values (?+)")
+	return fp
+}
+
+// fingerprintTable 从sql指纹中解析操作的表
+func fingerprintTable(fp string) string {
+	match := fingerprintTableReg.FindStringSubmatch(fp)
+	if len(match) < 2 {
+		return ""
+	}
+	return strings.ReplaceAll(match[1], "`", "")
+}
+
+// trimResolverMode 去除dbresolver追踪模式添加的[source]/[replica]前缀
+func trimResolverMode(sql string) string {
+	if strings.HasPrefix(sql, "[") {
+		if i := strings.Index(sql, "] "); i > 0 {
+			return sql[i+2:]
+		}
+	}
+	return sql
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func toLower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -20,11 +20,23 @@ type Config struct {
 	Database       string                          `mapstructure:"database" yaml:"database"`             // 要连接的数据库
 	Charset        string                          `mapstructure:"charset" yaml:"charset"`               // 字符集
 	Debug          bool                            `mapstructure:"debug" yaml:"debug"`                   // 是否开启调试模式
+	LoggerMode     LoggerMode                      `mapstructure:"logger_mode" yaml:"logger_mode"`       // 日志输出模式 structured-结构化输出(默认) console-控制台输出
 	MaxOpenConns   int                             `mapstructure:"max_open_conns" yaml:"max_open_conns"` // 设置数据库的最大打开连接数
 	MaxLifetime    int                             `mapstructure:"max_lifetime" yaml:"max_lifetime"`     // 设置连接可以重用的最长时间(单位：秒)
 	MaxIdleConns   int                             `mapstructure:"max_idle_conns" yaml:"max_idle_conns"` // 设置空闲连接池中的最大连接数
 	MaxIdleTime    int                             `mapstructure:"max_idle_time" yaml:"max_idle_time"`   // 设置空闲连接池中的最大连接数
 	SlowSqlHandler func(sql string, elapsed int64) // 慢sql处理器
+	SqlStats       *SqlStats                       // sql聚合统计，为nil时不统计
+	LogSampler     *LogSampler                     // info级别sql日志采样，为nil时不采样
+
+	// 调用位置定位
+	CallerSkipPackages []string `mapstructure:"caller_skip_packages" yaml:"caller_skip_packages"` // 定位调用位置时跳过的包前缀，如业务的repository封装，gorm和gormx默认跳过
+	ErrorStackDepth    int      `mapstructure:"error_stack_depth" yaml:"error_stack_depth"`       // sql错误日志附带的业务调用栈层数，0不附带
+
+	// 慢sql处理
+	ExplainSlowSql        bool                                            `mapstructure:"explain_slow_sql" yaml:"explain_slow_sql"` // 慢sql自动获取执行计划(仅select，优先从库执行)
+	SlowSqlExplainHandler func(sql string, elapsed int64, explain string) // 慢sql处理器（含执行计划）
+	SlowSqlEventHandler   func(event SlowSqlEvent)                        // 慢sql事件处理器（含context、影响行数、调用位置、表、执行目标）
 }
 
 // New  new *gorm.DB
@@ -37,6 +49,19 @@ func New(cfg Config) (db *gorm.DB, err error) {
 	}
 
 	// 自定义日志
+	loggerOpts := []LoggerOption{
+		WithLoggerMode(cfg.LoggerMode),
+		WithSqlStats(cfg.SqlStats),
+		WithLogSampler(cfg.LogSampler),
+		WithCallerSkipPackages(cfg.CallerSkipPackages...),
+		WithErrorStack(cfg.ErrorStackDepth),
+	}
+	if cfg.ExplainSlowSql || cfg.SlowSqlExplainHandler != nil {
+		loggerOpts = append(loggerOpts, WithSlowSqlExplain(cfg.SlowSqlExplainHandler))
+	}
+	if cfg.SlowSqlEventHandler != nil {
+		loggerOpts = append(loggerOpts, WithSlowSqlEventHandler(cfg.SlowSqlEventHandler))
+	}
 	myLogger := NewLogger(
 		log.New(os.Stdout, "\r\n", log.LstdFlags), // io writer（日志输出的目标，前缀和日志包含的内容——译者注）
 		logger.Config{
@@ -46,6 +71,7 @@ func New(cfg Config) (db *gorm.DB, err error) {
 			Colorful:                  true,         // 彩色打印
 		},
 		cfg.SlowSqlHandler,
+		loggerOpts...,
 	)
 
 	// 默认连接池为2
@@ -87,20 +113,40 @@ func New(cfg Config) (db *gorm.DB, err error) {
 		}
 	}
 
+	// 语句追踪，记录语句的执行节点
+	nodes := newNodeResolver(cfg.Addrs[0])
+	if err := registerTraceCallbacks(db, nodes); err != nil {
+		return nil, err
+	}
+	if err := registerBudgetCallbacks(db); err != nil {
+		return nil, err
+	}
+	if l, ok := myLogger.(*mylogger); ok && l.explainer != nil {
+		l.explainer.setDB(db)
+	}
+
 	if len(replicas) > 0 {
 		for {
-			err := db.Use(
-				dbresolver.Register(
-					dbresolver.Config{
-						Replicas:          replicas,                  // replicas
-						Policy:            dbresolver.RandomPolicy{}, // 负载均衡策略
-						TraceResolverMode: true,                      // 打印master/replicas mode 日志
-					}).
-					SetConnMaxIdleTime(time.Second * time.Duration(cfg.MaxIdleTime)).
-					SetConnMaxLifetime(time.Second * time.Duration(cfg.MaxLifetime)).
-					SetMaxIdleConns(cfg.MaxIdleConns).
-					SetMaxOpenConns(cfg.MaxOpenConns),
-			)
+			resolver := dbresolver.Register(
+				dbresolver.Config{
+					Replicas:          replicas,                  // replicas
+					Policy:            dbresolver.RandomPolicy{}, // 负载均衡策略
+					TraceResolverMode: true,                      // 打印master/replicas mode 日志
+				}).
+				SetConnMaxIdleTime(time.Second * time.Duration(cfg.MaxIdleTime)).
+				SetConnMaxLifetime(time.Second * time.Duration(cfg.MaxLifetime)).
+				SetMaxIdleConns(cfg.MaxIdleConns).
+				SetMaxOpenConns(cfg.MaxOpenConns)
+			// 连接池按master、replicas的顺序与Addrs一一对应
+			index := 0
+			resolver.Call(func(pool gorm.ConnPool) error {
+				if index < len(cfg.Addrs) {
+					nodes.add(pool, cfg.Addrs[index])
+				}
+				index++
+				return nil
+			})
+			err := db.Use(resolver)
 			if err != nil {
 				logx.Error(context.Background(), "replicas connection failed,retry...", logx.Err(err))
 			} else {
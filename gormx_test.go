@@ -1,15 +1,30 @@
 package gormx
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/dromara/carbon/v2"
+	mysqldriver "github.com/go-sql-driver/mysql"
 	"github.com/itmisx/logx"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
 )
 
 func TestGormx(t *testing.T) {
@@ -199,3 +214,1014 @@ func TestXxx(t *testing.T) {
 	earliestPartition, _ := strconv.Atoi(strings.ReplaceAll(carbon.Now().SubNanoseconds(int(time.Hour*300)).StartOfDay().ToDateString(), "-", ""))
 	fmt.Println(earliestPartition)
 }
+
+// newDryRunDB 不连接数据库的DryRun连接，用于测试callback及日志
+func newDryRunDB(t *testing.T, l logger.Interface) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "root:123456@tcp(127.0.0.1:13306)/test",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 l,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestFingerprint(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM `user` WHERE id IN (1, 2,3) AND name = 'tom'":          "select * from `user` where id in (?+) and name = ?",
+		"[replica] select * from t1 where id=10 limit 1":                      "select * from t1 where id=? limit ?",
+		"INSERT INTO `p20250101` (`a`,`b`) VALUES (1,'x'),(2,'it''s')":        "insert into `p20250101` (`a`,`b`) values (?+)",
+		"update t set  name = \"a\\\"b\" -- comment\n where created_at > 1.5": "update t set name = ? where created_at > ?",
+	}
+	for sql, want := range cases {
+		if got := Fingerprint(sql); got != want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+func TestFingerprintTable(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM `device` WHERE id = 1":                      "device",
+		"select count(*) from (select id from t) as a join u on 1": "t",
+		"INSERT INTO `db`.`user` (`a`) VALUES (1)":                 "db.user",
+		"UPDATE user SET a = 1":                                    "user",
+	}
+	for sql, want := range cases {
+		if got := fingerprintTable(Fingerprint(sql)); got != want {
+			t.Errorf("fingerprintTable(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	db := newDryRunDB(t, logger.Discard)
+	var records []AuditRecord
+	auditor := NewAuditor(AuditConfig{
+		Sink: AuditSinkFunc(func(ctx context.Context, batch []AuditRecord) error {
+			records = append(records, batch...)
+			return nil
+		}),
+	})
+	if err := db.Use(auditor); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ContextWithAuditActor(context.Background(), "tester")
+	db.WithContext(ctx).Create(&[]migrationTest{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}})
+	db.WithContext(ctx).Delete(&migrationTest{}, []int{3, 4})
+	db.WithContext(ctx).Exec("UPDATE migration_test SET name = ? WHERE id = ?", "c", 5)
+	auditor.Close()
+
+	want := []struct{ action, keys string }{
+		{AuditActionCreate, "[1,2]"},
+		{AuditActionDelete, "[3,4]"},
+		{AuditActionUpdate, ""},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d audit records %+v, want %d", len(records), records, len(want))
+	}
+	for i, w := range want {
+		r := records[i]
+		if r.Action != w.action || r.PrimaryKeys != w.keys || r.Table != "migration_test" || r.Actor != "tester" {
+			t.Errorf("record %d = %+v, want action %s keys %s", i, r, w.action, w.keys)
+		}
+	}
+}
+
+// stubConnPool 不连接数据库的连接池，用于测试事务
+type stubConnPool struct {
+	commitErr error // 提交事务返回的错误
+}
+
+func (stubConnPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (stubConnPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return stubResult{}, nil
+}
+
+func (stubConnPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func (stubConnPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+type stubResult struct{}
+
+func (stubResult) LastInsertId() (int64, error) { return 0, nil }
+func (stubResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (p stubConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &stubTx{p}, nil
+}
+
+type stubTx struct{ stubConnPool }
+
+func (tx stubTx) Commit() error                                          { return tx.commitErr }
+func (stubTx) Rollback() error                                           { return nil }
+func (stubTx) StmtContext(ctx context.Context, stmt *sql.Stmt) *sql.Stmt { return stmt }
+
+func TestAuditTransaction(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      stubConnPool{},
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []AuditRecord
+	auditor := NewAuditor(AuditConfig{
+		Sink: AuditSinkFunc(func(ctx context.Context, batch []AuditRecord) error {
+			records = append(records, batch...)
+			return nil
+		}),
+	})
+	if err := db.Use(auditor); err != nil {
+		t.Fatal(err)
+	}
+
+	// 回滚的事务不记录
+	tx := db.Begin()
+	tx.Create(&migrationTest{ID: 1, Name: "a"})
+	if pending := auditTxOf(tx.Statement.ConnPool); pending == nil || len(pending.records) != 1 {
+		t.Fatalf("audit record should be buffered in the transaction")
+	}
+	tx.Rollback()
+	// 提交的事务及默认事务
+	db.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&migrationTest{ID: 2, Name: "b"})
+		return tx.Exec("UPDATE migration_test SET name = ? WHERE id = ?", "c", 2).Error
+	})
+	db.Transaction(func(tx *gorm.DB) error {
+		tx.Create(&migrationTest{ID: 3, Name: "c"})
+		return errors.New("rollback")
+	})
+	db.Delete(&migrationTest{}, 4)
+	auditor.Close()
+
+	want := []struct{ action, keys string }{
+		{AuditActionCreate, "[2]"},
+		{AuditActionUpdate, ""},
+		{AuditActionDelete, "[4]"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("got %d audit records %+v, want %d", len(records), records, len(want))
+	}
+	for i, w := range want {
+		if r := records[i]; r.Action != w.action || r.PrimaryKeys != w.keys {
+			t.Errorf("record %d = %+v, want action %s keys %s", i, r, w.action, w.keys)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	deadlock := &mysqldriver.MySQLError{Number: 1213}
+	opts := RetryOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	attempts := 0
+	err := retry(context.Background(), opts, func() error {
+		attempts++
+		return deadlock
+	})
+	if attempts != 3 || !errors.Is(err, deadlock) {
+		t.Errorf("attempts = %d, err = %v, want 3 attempts", attempts, err)
+	}
+	// 不可重试的错误
+	attempts = 0
+	retry(context.Background(), opts, func() error {
+		attempts++
+		return errors.New("syntax error")
+	})
+	if attempts != 1 {
+		t.Errorf("attempts = %d for non-retryable error, want 1", attempts)
+	}
+	// context取消后停止重试
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	retry(ctx, RetryOptions{MaxAttempts: 5, InitialBackoff: time.Hour, Retryable: func(error) bool { return true }}, func() error {
+		attempts++
+		cancel()
+		return deadlock
+	})
+	if attempts != 1 {
+		t.Errorf("attempts = %d after context canceled, want 1", attempts)
+	}
+}
+
+func TestRetryTransactionInTransaction(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      stubConnPool{},
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := db.Begin()
+	defer tx.Rollback()
+	deadlock := &mysqldriver.MySQLError{Number: 1213}
+	attempts := 0
+	err = RetryTransaction(context.Background(), tx, func(tx *gorm.DB) error {
+		attempts++
+		return deadlock
+	}, RetryOptions{InitialBackoff: time.Millisecond})
+	if attempts != 1 || !errors.Is(err, deadlock) {
+		t.Errorf("attempts = %d, err = %v, want no retry in transaction", attempts, err)
+	}
+}
+
+func TestAuditTransactionResolver(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      stubConnPool{},
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// dbresolver在开启默认事务前切换到source连接池
+	commitErr := errors.New("commit failed")
+	err = db.Use(dbresolver.Register(dbresolver.Config{
+		Sources:  []gorm.Dialector{mysql.New(mysql.Config{Conn: stubConnPool{commitErr: commitErr}, SkipInitializeWithVersion: true})},
+		Replicas: []gorm.Dialector{mysql.New(mysql.Config{Conn: stubConnPool{}, SkipInitializeWithVersion: true})},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []AuditRecord
+	auditor := NewAuditor(AuditConfig{
+		Sink: AuditSinkFunc(func(ctx context.Context, batch []AuditRecord) error {
+			records = append(records, batch...)
+			return nil
+		}),
+	})
+	if err := db.Use(auditor); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&migrationTest{ID: 1, Name: "a"}).Error; !errors.Is(err, commitErr) {
+		t.Fatalf("err = %v, want commit error", err)
+	}
+	auditor.Close()
+	if len(records) != 0 {
+		t.Errorf("got audit records %+v for a failed commit", records)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	if line := fileWithLineNum(nil); !strings.Contains(line, "gormx_test.go") {
+		t.Errorf("fileWithLineNum() = %q, want caller in gormx_test.go", line)
+	}
+	if stack := shortStack(nil, 2); len(stack) != 2 || !strings.Contains(stack[0], "TestCaller") {
+		t.Errorf("shortStack() = %v", stack)
+	}
+}
+
+func TestLoggerMode(t *testing.T) {
+	cases := []struct {
+		mode       LoggerMode
+		env        string
+		localDebug bool
+		console    bool
+	}{
+		{mode: LoggerModeConsole, env: "structured", console: true},
+		{mode: LoggerModeStructured, env: "console", localDebug: true, console: false},
+		{env: "console", console: true},
+		{env: "CONSOLE", console: true},
+		{env: "structured", localDebug: true, console: false},
+		{env: "pretty", localDebug: true, console: true},
+		{env: "pretty", console: false},
+		{mode: "pretty", env: "console", console: true},
+		{localDebug: true, console: true},
+		{console: false},
+	}
+	defer func(localDebug bool) { LocalDebug = localDebug }(LocalDebug)
+	for _, c := range cases {
+		t.Setenv(LoggerModeEnv, c.env)
+		LocalDebug = c.localDebug
+		l := NewLogger(log.New(io.Discard, "", 0), logger.Config{}, nil, WithLoggerMode(c.mode)).(*mylogger)
+		if got := l.console(); got != c.console {
+			t.Errorf("mode %q env %q LocalDebug %v: console() = %v, want %v", c.mode, c.env, c.localDebug, got, c.console)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	dup := fmt.Errorf("create user: %w", &mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'PRIMARY'"})
+	if !IsDuplicateKey(dup) || IsDeadlock(dup) || ErrorClass(dup) != "duplicate_key" {
+		t.Errorf("classify %v failed", dup)
+	}
+	deadlock := TranslateError(&mysqldriver.MySQLError{Number: 1213})
+	if !errors.Is(deadlock, ErrDeadlock) || MySQLErrorNumber(deadlock) != 1213 {
+		t.Errorf("translate %v failed", deadlock)
+	}
+	if !IsConnectionLost(driver.ErrBadConn) || !IsDuplicateKey(gorm.ErrDuplicatedKey) {
+		t.Error("classify driver/gorm errors failed")
+	}
+	if err := errors.New("x"); ClassifyError(err) != nil || TranslateError(err) != err {
+		t.Error("unknown error should not be classified")
+	}
+}
+
+func TestNPlusOne(t *testing.T) {
+	db := newDryRunDB(t, NewLogger(nil, logger.Config{LogLevel: logger.Silent}, nil))
+	ctx, detector := ContextWithNPlusOneDetector(context.Background(), 3)
+	for i := 0; i < 5; i++ {
+		var record migrationTest
+		db.WithContext(ctx).Where("id = ?", i).Take(&record)
+	}
+	db.WithContext(ctx).Create(&migrationTest{Name: "a"})
+	reports := detector.Reports()
+	if len(reports) != 1 || reports[0].Count != 5 {
+		t.Fatalf("reports = %+v, want one report with 5 queries", reports)
+	}
+	if err := detector.Err(); err == nil || !strings.Contains(err.Error(), "gormx_test.go") {
+		t.Errorf("Err() = %v, want report with caller", err)
+	}
+}
+
+func TestSlowSqlEvent(t *testing.T) {
+	var events []SlowSqlEvent
+	db := newDryRunDB(t, NewLogger(
+		log.New(io.Discard, "", 0),
+		logger.Config{LogLevel: logger.Warn, SlowThreshold: time.Nanosecond},
+		nil,
+		WithLoggerMode(LoggerModeConsole),
+		WithSlowSqlEventHandler(func(event SlowSqlEvent) { events = append(events, event) }),
+	))
+	nodes := newNodeResolver("127.0.0.1:3306")
+	if err := registerTraceCallbacks(db, nodes); err != nil {
+		t.Fatal(err)
+	}
+	var record migrationTest
+	db.Where("id = ?", 1).Take(&record)
+	if len(events) != 1 {
+		t.Fatalf("got %d slow sql events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Table != "migration_test" || event.Node != "127.0.0.1:3306" || event.Target != "source" || !strings.Contains(event.Caller, "gormx_test.go") {
+		t.Errorf("event = %+v", event)
+	}
+}
+
+func TestSlowSqlEventRawSql(t *testing.T) {
+	var event SlowSqlEvent
+	l := NewLogger(
+		log.New(io.Discard, "", 0),
+		logger.Config{LogLevel: logger.Warn, SlowThreshold: time.Nanosecond},
+		nil,
+		WithLoggerMode(LoggerModeConsole),
+		WithSlowSqlEventHandler(func(e SlowSqlEvent) { event = e }),
+	)
+	raw := "SELECT id\nFROM users\nWHERE id = 1"
+	l.Trace(context.Background(), time.Now().Add(-time.Second), func() (string, int64) { return raw, 1 }, nil)
+	// 执行计划使用未去除换行符的sql
+	if event.rawSql != raw {
+		t.Errorf("raw sql = %q, want %q", event.rawSql, raw)
+	}
+	// 指纹与SqlStats一致
+	if event.Fingerprint != Fingerprint(raw) || event.Table != "users" {
+		t.Errorf("fingerprint = %q, table = %q, want %q", event.Fingerprint, event.Table, Fingerprint(raw))
+	}
+}
+
+func TestLogSamplerContextOverride(t *testing.T) {
+	var buf strings.Builder
+	l := NewLogger(
+		log.New(&buf, "", 0),
+		logger.Config{LogLevel: logger.Info},
+		nil,
+		WithLoggerMode(LoggerModeConsole),
+		WithLogSampler(NewLogSampler(0, 1)),
+	)
+	fc := func() (string, int64) { return "SELECT * FROM users WHERE id = 1", 1 }
+	for i := 0; i < 3; i++ {
+		l.Trace(context.Background(), time.Now(), fc, nil)
+	}
+	if n := strings.Count(buf.String(), "SELECT"); n != 1 {
+		t.Fatalf("got %d sql logs without override, want 1", n)
+	}
+	buf.Reset()
+	// 覆盖日志级别时不采样
+	ctx := ContextWithLogLevel(context.Background(), logger.Info)
+	for i := 0; i < 3; i++ {
+		l.Trace(ctx, time.Now(), fc, nil)
+	}
+	if n := strings.Count(buf.String(), "SELECT"); n != 3 {
+		t.Errorf("got %d sql logs with override, want 3", n)
+	}
+}
+
+func TestLogSamplerReportSuppressed(t *testing.T) {
+	var buf strings.Builder
+	sampler := NewLogSampler(0, 1)
+	l := NewLogger(log.New(&buf, "", 0), logger.Config{LogLevel: logger.Info}, nil,
+		WithLoggerMode(LoggerModeConsole), WithLogSampler(sampler))
+	fc := func() (string, int64) { return "SELECT * FROM users WHERE id = 1", 1 }
+	for i := 0; i < 3; i++ {
+		l.Trace(context.Background(), time.Now(), fc, nil)
+	}
+	// 到达输出间隔后，下一条被记录的日志输出被抑制的条数
+	sampler.mu.Lock()
+	sampler.lastReport = time.Now().Add(-DefaultSuppressedReportInterval)
+	sampler.mu.Unlock()
+	l.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT * FROM orders WHERE id = 1", 1 }, nil)
+	if !strings.Contains(buf.String(), "2 sql info logs suppressed") {
+		t.Errorf("output = %q, want suppressed report from the allowed line", buf.String())
+	}
+}
+
+func TestQueryBudget(t *testing.T) {
+	db := newDryRunDB(t, NewLogger(nil, logger.Config{LogLevel: logger.Silent}, nil))
+	if err := registerBudgetCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+	ctx, budget := ContextWithQueryBudget(context.Background(), QueryBudget{MaxQueries: 2, Enforce: true})
+	var errs []error
+	for i := 0; i < 4; i++ {
+		var record migrationTest
+		errs = append(errs, db.WithContext(ctx).Where("id = ?", i).Take(&record).Error)
+	}
+	if errs[1] != nil || !errors.Is(errs[2], ErrQueryBudgetExceeded) || !errors.Is(errs[3], ErrQueryBudgetExceeded) {
+		t.Fatalf("errs = %v, want the 3rd and 4th queries rejected", errs)
+	}
+	summary := budget.Summary()
+	if summary.Queries != 2 || summary.Exceeded != "queries" || summary.Rejected != 2 {
+		t.Errorf("summary = %+v", summary)
+	}
+	var exceeded *QueryBudgetExceededError
+	if !errors.As(budget.Err(), &exceeded) || exceeded.Budget.MaxQueries != 2 {
+		t.Errorf("Err() = %v", budget.Err())
+	}
+
+	// 内部语句不计入预算
+	ctx, budget = ContextWithQueryBudget(context.Background(), QueryBudget{MaxQueries: 1, Enforce: true})
+	var record migrationTest
+	if err := db.WithContext(ctx).InstanceSet(internalStatementKey, true).Take(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	if summary := budget.Summary(); summary.Queries != 0 {
+		t.Errorf("internal statement counted in budget: %+v", summary)
+	}
+}
+
+func TestQueryBudgetWarnConsole(t *testing.T) {
+	var buf bytes.Buffer
+	db := newDryRunDB(t, NewLogger(log.New(&buf, "", 0), logger.Config{LogLevel: logger.Silent}, nil, WithLoggerMode(LoggerModeConsole)))
+	if err := registerBudgetCallbacks(db); err != nil {
+		t.Fatal(err)
+	}
+	ctx, _ := ContextWithQueryBudget(context.Background(), QueryBudget{MaxQueries: 1})
+	for i := 0; i < 2; i++ {
+		var record migrationTest
+		db.WithContext(ctx).Where("id = ?", i).Take(&record)
+	}
+	if out := buf.String(); !strings.Contains(out, "QUERY BUDGET EXCEEDED queries") || !strings.Contains(out, "gormx_test.go") {
+		t.Errorf("output = %q, want console warning with caller", out)
+	}
+}
+
+func TestPartitionPendingBounds(t *testing.T) {
+	now := time.Date(2025, 1, 10, 15, 0, 0, 0, time.Local)
+	format := func(bounds []time.Time) []string {
+		var names []string
+		for _, bound := range bounds {
+			if bound.Hour() != 0 {
+				names = append(names, bound.Format(time.DateTime))
+			} else {
+				names = append(names, bound.Format(time.DateOnly))
+			}
+		}
+		return names
+	}
+	cases := []struct {
+		unit       PartitionUnitT
+		horizon    int
+		partitions []string
+		want       []string
+	}{
+		// 已存在当前周期的分区，预创建3天
+		{PartitionUnitDay, 3, []string{"p20250110", "p20250111"}, []string{"2025-01-12", "2025-01-13", "2025-01-14"}},
+		// 停机导致缺失的分区需补齐
+		{PartitionUnitDay, 1, []string{"p20250108", "pmax"}, []string{"2025-01-09", "2025-01-10", "2025-01-11", "2025-01-12"}},
+		// 已覆盖到预创建范围
+		{PartitionUnitMonth, 1, []string{"p20250201", "p20250301"}, nil},
+		{PartitionUnitYear, 0, nil, []string{"2026-01-01"}},
+		{PartitionUnitHour, 2, []string{"p2025011015"}, []string{"2025-01-10 16:00:00", "2025-01-10 17:00:00", "2025-01-10 18:00:00"}},
+		// 2025-01-10为周五，当前周期的分区上界为下周一
+		{PartitionUnitWeek, 1, []string{"p2025w02"}, []string{"2025-01-13", "2025-01-20"}},
+	}
+	for _, c := range cases {
+		p := NewPartition(nil, "test", "test", c.unit, 0, WithPartitionHorizon(c.horizon))
+		if got := format(p.pendingBounds(c.partitions, now)); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("unit %d horizon %d partitions %v: got %v, want %v", c.unit, c.horizon, c.partitions, got, c.want)
+		}
+	}
+}
+
+func TestPartitionKeyType(t *testing.T) {
+	cases := []struct {
+		method     string
+		expression string
+		want       PartitionKeyT
+		value      string
+	}{
+		{"RANGE", "`created_at`", PartitionKeyUnixTimestamp, "UNIX_TIMESTAMP('2025-01-01')"},
+		{"RANGE", "unix_timestamp(`created_at`)", PartitionKeyUnixTimestamp, "UNIX_TIMESTAMP('2025-01-01')"},
+		{"RANGE COLUMNS", "`created_date`", PartitionKeyColumns, "'2025-01-01'"},
+		{"RANGE", "to_days(`created_date`)", PartitionKeyToDays, "TO_DAYS('2025-01-01')"},
+	}
+	bound := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	p := NewPartition(nil, "test", "test", PartitionUnitDay, 0)
+	for _, c := range cases {
+		keyType, err := parsePartitionKeyType(c.method, c.expression)
+		if err != nil || keyType != c.want {
+			t.Errorf("%s %s: got %d %v, want %d", c.method, c.expression, keyType, err, c.want)
+		}
+		if value := p.rangeValue(keyType, bound); value != c.value {
+			t.Errorf("%s %s: value %s, want %s", c.method, c.expression, value, c.value)
+		}
+	}
+	// 无法生成分区上界的表达式
+	unsupported := []struct{ method, expression string }{
+		{"LIST", "`type`"},
+		{"RANGE", "year(`created`)"},
+		{"RANGE", "floor((`ts` / 1000))"},
+		{"RANGE", "to_days(`created_date`) + 1"},
+		{"RANGE COLUMNS", "`created_date`,`id`"},
+	}
+	for _, c := range unsupported {
+		if _, err := parsePartitionKeyType(c.method, c.expression); !errors.Is(err, ErrUnsupportedPartitionKey) {
+			t.Errorf("%s %s: err = %v", c.method, c.expression, err)
+		}
+	}
+}
+
+func TestPartitionKeyEncoding(t *testing.T) {
+	bound := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+	p := NewPartition(nil, "test", "test", PartitionUnitDay, 0, WithPartitionKeyEncoding(KeyEncodingMilliseconds))
+	if value := p.rangeValue(PartitionKeyUnixTimestamp, bound); value != strconv.FormatInt(bound.UnixMilli(), 10) {
+		t.Errorf("rangeValue = %s, want %d", value, bound.UnixMilli())
+	}
+	cases := []struct {
+		partition partitionInfo
+		want      bool
+	}{
+		{partitionInfo{Name: "p20241231", Description: strconv.FormatInt(bound.AddDate(0, 0, -1).UnixMilli(), 10)}, true},
+		{partitionInfo{Name: "p20250101", Description: strconv.FormatInt(bound.UnixMilli(), 10)}, true},
+		{partitionInfo{Name: "p20250102", Description: strconv.FormatInt(bound.AddDate(0, 0, 1).UnixMilli(), 10)}, false},
+		{partitionInfo{Name: "pmax", Description: "MAXVALUE"}, false},
+	}
+	for _, c := range cases {
+		if got := p.expired(PartitionKeyUnixTimestamp, c.partition, bound); got != c.want {
+			t.Errorf("expired(%+v) = %v, want %v", c.partition, got, c.want)
+		}
+	}
+}
+
+func TestPartitionName(t *testing.T) {
+	cases := []struct {
+		unit  PartitionUnitT
+		bound time.Time
+		name  string
+	}{
+		{PartitionUnitDay, time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local), "p20250101"},
+		{PartitionUnitHour, time.Date(2025, 1, 1, 13, 0, 0, 0, time.Local), "p2025010113"},
+		{PartitionUnitWeek, time.Date(2025, 1, 27, 0, 0, 0, 0, time.Local), "p2025w05"},
+		// 2024-12-30所在周为2025年第1周
+		{PartitionUnitWeek, time.Date(2024, 12, 30, 0, 0, 0, 0, time.Local), "p2025w01"},
+	}
+	for _, c := range cases {
+		p := NewPartition(nil, "test", "test", c.unit, 0)
+		if name := p.partitionName(c.bound); name != c.name {
+			t.Errorf("partitionName(%v) = %s, want %s", c.bound, name, c.name)
+		}
+		if bound, ok := p.parsePartitionName(c.name); !ok || !bound.Equal(c.bound) {
+			t.Errorf("parsePartitionName(%s) = %v %v, want %v", c.name, bound, ok, c.bound)
+		}
+	}
+	if _, ok := NewPartition(nil, "test", "test", PartitionUnitWeek, 0).parsePartitionName("pmax"); ok {
+		t.Errorf("pmax should not be parsed")
+	}
+}
+
+// stubDriver 不连接数据库的驱动，执行语句直接成功，查询分区数据时返回rows行(id从1开始)，其他查询返回空结果
+// 模拟mysql驱动的文本协议和二进制协议：没有绑定参数时返回[]byte，有绑定参数时整数列返回int64
+type stubDriver struct{ rows int }
+
+func (d stubDriver) Open(name string) (driver.Conn, error)            { return stubDriverConn(d), nil }
+func (d stubDriver) Connect(ctx context.Context) (driver.Conn, error) { return stubDriverConn(d), nil }
+func (d stubDriver) Driver() driver.Driver                            { return d }
+
+// newStubDriverDB 使用stubDriver的连接
+func newStubDriverDB(t *testing.T, rows int) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sql.OpenDB(stubDriver{rows: rows}), SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type stubDriverConn stubDriver
+
+func (c stubDriverConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c stubDriverConn) Close() error              { return nil }
+func (c stubDriverConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (c stubDriverConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+
+func (c stubDriverConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows := &stubDriverRows{columns: []string{"id", "name"}, types: []string{"BIGINT", "VARCHAR"}}
+	if !strings.Contains(query, " PARTITION (") {
+		return rows, nil
+	}
+	binary := len(args) > 0
+	if strings.HasPrefix(query, "SELECT COUNT(*)") {
+		return &stubDriverRows{columns: []string{"COUNT(*)"}, types: []string{"BIGINT"}, values: [][]driver.Value{{[]byte(strconv.Itoa(c.rows))}}}, nil
+	}
+	var lastKey int64
+	if binary {
+		lastKey = args[0].Value.(int64)
+	}
+	limit, _ := strconv.Atoi(query[strings.LastIndex(query, " ")+1:])
+	for id := lastKey + 1; id <= int64(c.rows) && len(rows.values) < limit; id++ {
+		var value driver.Value = []byte(strconv.FormatInt(id, 10))
+		if binary {
+			value = id
+		}
+		rows.values = append(rows.values, []driver.Value{value, []byte("name")})
+	}
+	return rows, nil
+}
+
+type stubDriverRows struct {
+	columns []string
+	types   []string
+	values  [][]driver.Value
+}
+
+func (r *stubDriverRows) Columns() []string                       { return r.columns }
+func (r *stubDriverRows) ColumnTypeDatabaseTypeName(i int) string { return r.types[i] }
+func (r *stubDriverRows) Close() error                            { return nil }
+func (r *stubDriverRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestExportArchiverChunks(t *testing.T) {
+	db := newStubDriverDB(t, 5)
+	dir := t.TempDir()
+	archiver := &ExportArchiver{Writer: NewArchiveFileWriter(dir, ArchiveFormatJSONL), ChunkSize: 2}
+	if err := archiver.Archive(context.Background(), db, "orders", "p20250101"); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filepath.Join(dir, "orders_p20250101.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(gz)
+	// 各批次的id均为数字
+	want := `{"id":1,"name":"name"}` + "\n" + `{"id":2,"name":"name"}` + "\n" + `{"id":3,"name":"name"}` + "\n" +
+		`{"id":4,"name":"name"}` + "\n" + `{"id":5,"name":"name"}` + "\n"
+	if string(b) != want {
+		t.Errorf("archive file = %s\nwant %s", b, want)
+	}
+}
+
+func TestArchiveFileWriter(t *testing.T) {
+	for _, format := range []ArchiveFormat{ArchiveFormatJSONL, ArchiveFormatCSV} {
+		writer := NewArchiveFileWriter(t.TempDir(), format)
+		file, err := writer.Open(context.Background(), "orders", "p20250101")
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns := []string{"id", "name", "created_at"}
+		for i := 0; i < 3; i++ {
+			if err := file.Write(columns, [][]any{{int64(i*2 + 1), "a,b", nil}, {int64(i*2 + 2), "c\nd", time.Now()}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		written, err := file.Commit()
+		if err != nil || written != 6 {
+			t.Errorf("%s: Commit() = %d %v, want 6", format, written, err)
+		}
+		if _, err := os.Stat(filepath.Join(writer.dir, "orders_p20250101."+string(format)+".gz")); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+}
+
+func TestPartitionReorganize(t *testing.T) {
+	p := NewPartition(nil, "test", "orders", PartitionUnitDay, 0)
+	bounds := []time.Time{time.Date(2025, 1, 2, 0, 0, 0, 0, time.Local), time.Date(2025, 1, 3, 0, 0, 0, 0, time.Local)}
+	sqls := p.addPartitionSQLs(PartitionKeyColumns, bounds, "")
+	if len(sqls) != 2 || sqls[0] != "ALTER TABLE orders ADD PARTITION(PARTITION p20250102 VALUES LESS THAN ('2025-01-02'))" {
+		t.Errorf("add sqls = %v", sqls)
+	}
+	sqls = p.addPartitionSQLs(PartitionKeyColumns, bounds, "pmax")
+	want := "ALTER TABLE orders REORGANIZE PARTITION pmax INTO (" +
+		"PARTITION p20250102 VALUES LESS THAN ('2025-01-02'), " +
+		"PARTITION p20250103 VALUES LESS THAN ('2025-01-03'), " +
+		"PARTITION pmax VALUES LESS THAN MAXVALUE)"
+	if len(sqls) != 1 || sqls[0] != want {
+		t.Errorf("reorganize sqls = %v, want %s", sqls, want)
+	}
+}
+
+func TestPartitionBootstrapSQL(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	p := NewPartition(nil, "test", "orders", PartitionUnitMonth, 0)
+	info := bootstrapInfo{
+		dataType:    "bigint",
+		primaryKeys: []string{"id"},
+		min:         sql.NullInt64{Int64: time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local).Unix(), Valid: true},
+		max:         sql.NullInt64{Int64: time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local).Unix(), Valid: true},
+	}
+	ddl, err := p.bootstrapSQL("created_at", info, now)
+	want := "ALTER TABLE orders DROP PRIMARY KEY, ADD PRIMARY KEY (id, created_at) PARTITION BY RANGE (created_at) (" +
+		"PARTITION p20250201 VALUES LESS THAN (UNIX_TIMESTAMP('2025-02-01')), " +
+		"PARTITION p20250301 VALUES LESS THAN (UNIX_TIMESTAMP('2025-03-01')), " +
+		"PARTITION p20250401 VALUES LESS THAN (UNIX_TIMESTAMP('2025-04-01')), " +
+		"PARTITION p20250501 VALUES LESS THAN (UNIX_TIMESTAMP('2025-05-01')))"
+	if err != nil || ddl != want {
+		t.Errorf("bootstrapSQL() = %s %v\nwant %s", ddl, err, want)
+	}
+	// DATETIME列，主键已包含分区列，最大值超出预创建范围
+	info = bootstrapInfo{
+		dataType:    "datetime",
+		primaryKeys: []string{"id", "created_at"},
+		minTime:     sql.NullTime{Time: time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local), Valid: true},
+		maxTime:     sql.NullTime{Time: time.Date(2025, 5, 1, 0, 0, 0, 0, time.Local), Valid: true},
+	}
+	ddl, err = p.bootstrapSQL("created_at", info, now)
+	want = "ALTER TABLE orders PARTITION BY RANGE COLUMNS(created_at) (" +
+		"PARTITION p20250401 VALUES LESS THAN ('2025-04-01'), " +
+		"PARTITION p20250501 VALUES LESS THAN ('2025-05-01'), " +
+		"PARTITION p20250601 VALUES LESS THAN ('2025-06-01'))"
+	if err != nil || ddl != want {
+		t.Errorf("bootstrapSQL() = %s %v\nwant %s", ddl, err, want)
+	}
+
+	// DATETIME按分区时区解析，TIMESTAMP为时间戳
+	shanghai := time.FixedZone("Asia/Shanghai", 8*3600)
+	p = NewPartition(nil, "test", "orders", PartitionUnitDay, 0, WithPartitionLocation(shanghai))
+	value, err := p.parseBootstrapTime("datetime", sql.NullString{String: "2025-03-01 00:30:00", Valid: true})
+	if err != nil || !value.Time.Equal(time.Date(2025, 3, 1, 0, 30, 0, 0, shanghai)) {
+		t.Errorf("parseBootstrapTime(datetime) = %v %v", value, err)
+	}
+	value, err = p.parseBootstrapTime("timestamp", sql.NullString{String: "1740760200", Valid: true})
+	if err != nil || !value.Time.Equal(time.Date(2025, 3, 1, 0, 30, 0, 0, shanghai)) {
+		t.Errorf("parseBootstrapTime(timestamp) = %v %v", value, err)
+	}
+	if value, err = p.parseBootstrapTime("date", sql.NullString{}); err != nil || value.Valid {
+		t.Errorf("parseBootstrapTime(NULL) = %v %v", value, err)
+	}
+}
+
+func TestPartitionStartStop(t *testing.T) {
+	p := NewPartition(newStubDriverDB(t, 0), "test", "orders", PartitionUnitDay, time.Hour*24*7,
+		WithPartitionLock(false), WithPartitionKeyType(PartitionKeyUnixTimestamp))
+	if err := p.RunOnce(context.Background()); err != nil {
+		t.Fatalf("RunOnce() err = %v", err)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatalf("Start() err = %v", err)
+	}
+	if err := p.Start(context.Background()); !errors.Is(err, ErrPartitionStarted) {
+		t.Errorf("second Start() err = %v, want ErrPartitionStarted", err)
+	}
+	done := p.done
+	p.Stop()
+	// Stop等待定时检查协程退出
+	select {
+	case <-done:
+	default:
+		t.Error("Stop() returned before the maintenance goroutine exited")
+	}
+	p.Stop()
+	// 停止后可再次启动
+	if err := p.Start(context.Background()); err != nil {
+		t.Errorf("Start() after Stop() err = %v", err)
+	}
+	p.Stop()
+
+	p = NewPartition(newStubDriverDB(t, 0), "test", "orders", PartitionUnitT(10), 0, WithPartitionLock(false))
+	if err := p.Start(context.Background()); !errors.Is(err, ErrUnsupportedPartitionUnit) {
+		t.Errorf("Start() err = %v, want ErrUnsupportedPartitionUnit", err)
+	}
+}
+
+func TestPartitionUnitMismatch(t *testing.T) {
+	cases := []struct {
+		unit     PartitionUnitT
+		keyType  PartitionKeyT
+		dataType string
+		err      error
+	}{
+		{PartitionUnitHour, PartitionKeyToDays, "datetime", ErrPartitionUnitMismatch},
+		{PartitionUnitHour, PartitionKeyColumns, "date", ErrPartitionUnitMismatch},
+		{PartitionUnitHour, PartitionKeyColumns, "datetime", nil},
+		{PartitionUnitHour, PartitionKeyUnixTimestamp, "bigint", nil},
+		{PartitionUnitDay, PartitionKeyToDays, "date", nil},
+		{PartitionUnitT(0), PartitionKeyUnixTimestamp, "bigint", ErrUnsupportedPartitionUnit},
+	}
+	for _, c := range cases {
+		p := NewPartition(nil, "test", "orders", c.unit, 0, WithPartitionKeyType(c.keyType))
+		if err := p.validateUnit(c.keyType, c.dataType); !errors.Is(err, c.err) {
+			t.Errorf("unit %d key %d %s: err = %v, want %v", c.unit, c.keyType, c.dataType, err, c.err)
+		}
+	}
+	// 转换及启动时校验
+	p := NewPartition(nil, "test", "orders", PartitionUnitHour, 0)
+	info := bootstrapInfo{dataType: "date", primaryKeys: []string{"id"}}
+	if _, err := p.bootstrapSQL("created_date", info, time.Now()); !errors.Is(err, ErrPartitionUnitMismatch) {
+		t.Errorf("bootstrapSQL() err = %v, want ErrPartitionUnitMismatch", err)
+	}
+	p = NewPartition(nil, "test", "orders", PartitionUnitHour, 0, WithPartitionKeyType(PartitionKeyToDays))
+	if err := p.Start(context.Background()); !errors.Is(err, ErrPartitionUnitMismatch) {
+		t.Errorf("Start() err = %v, want ErrPartitionUnitMismatch", err)
+	}
+}
+
+func TestPartitionLockName(t *testing.T) {
+	if name := NewPartition(nil, "test", "orders", PartitionUnitDay, 0).lockName(); name != "gormx:partition:test.orders" {
+		t.Errorf("lockName() = %s", name)
+	}
+	if name := NewPartition(nil, "test", strings.Repeat("t", 64), PartitionUnitDay, 0).lockName(); len(name) > 64 {
+		t.Errorf("lockName() = %s, longer than 64", name)
+	}
+}
+
+func TestPartitionLocation(t *testing.T) {
+	shanghai := time.FixedZone("Asia/Shanghai", 8*3600)
+	p := NewPartition(nil, "test", "orders", PartitionUnitDay, 0, WithPartitionLocation(shanghai))
+	now := time.Date(2024, 12, 31, 20, 0, 0, 0, time.UTC) // 上海时间 2025-01-01 04:00
+	bounds := p.pendingBounds(nil, now.In(shanghai))
+	if len(bounds) != 2 || p.partitionName(bounds[0]) != "p20250102" {
+		t.Fatalf("bounds = %v", bounds)
+	}
+	// 上海时间 2025-01-02 00:00 即 UTC 2025-01-01 16:00
+	if value := p.rangeValue(PartitionKeyUnixTimestamp, bounds[0]); value != strconv.FormatInt(time.Date(2025, 1, 1, 16, 0, 0, 0, time.UTC).Unix(), 10) {
+		t.Errorf("rangeValue = %s", value)
+	}
+	if bound, ok := p.parsePartitionName("p20250102"); !ok || !bound.Equal(bounds[0]) {
+		t.Errorf("parsePartitionName = %v %v, want %v", bound, ok, bounds[0])
+	}
+}
+
+// archiverFunc 回调函数形式的归档，用于测试
+type archiverFunc func(ctx context.Context, db *gorm.DB, table string, partition string) error
+
+func (f archiverFunc) Archive(ctx context.Context, db *gorm.DB, table string, partition string) error {
+	return f(ctx, db, table, partition)
+}
+
+func TestPartitionArchiveTimeout(t *testing.T) {
+	var archived []string
+	p := NewPartition(newDryRunDB(t, logger.Discard), "test", "orders", PartitionUnitDay, time.Hour*24,
+		WithPartitionArchiveTimeout(time.Hour*2),
+		WithPartitionArchiver(archiverFunc(func(ctx context.Context, db *gorm.DB, table string, partition string) error {
+			deadline, ok := ctx.Deadline()
+			if ctx.Err() != nil || !ok || time.Until(deadline) <= DefaultPartitionTimeout {
+				t.Errorf("archive ctx err = %v, deadline = %v, want not bounded by the add partition timeout", ctx.Err(), deadline)
+			}
+			archived = append(archived, partition)
+			return nil
+		})))
+	plan := &PartitionPlan{
+		Table:      "orders",
+		CreateSQLs: []string{"ALTER TABLE orders ADD PARTITION(PARTITION p20250112 VALUES LESS THAN (1736640000))"},
+		Drop:       []PlannedPartition{{Name: "p20250107", Archive: true, SQL: "ALTER TABLE orders DROP PARTITION p20250107"}},
+	}
+	// 创建分区的超时已结束
+	addCtx, cancel := context.WithTimeout(context.Background(), DefaultPartitionTimeout)
+	cancel()
+	if err := p.apply(addCtx, context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+	if len(archived) != 1 {
+		t.Errorf("archived = %v, want [p20250107]", archived)
+	}
+}
+
+func TestPartitionPlan(t *testing.T) {
+	now := time.Date(2025, 1, 10, 15, 0, 0, 0, time.Local)
+	p := NewPartition(nil, "test", "orders", PartitionUnitDay, time.Hour*24*2,
+		WithPartitionArchiver(&ExchangeArchiver{}))
+	day := func(d int) string {
+		return strconv.FormatInt(time.Date(2025, 1, d, 0, 0, 0, 0, time.Local).Unix(), 10)
+	}
+	partitions := []partitionInfo{
+		{Name: "p20250107", Description: day(7), Rows: 100},
+		{Name: "p20250108", Description: day(8), Rows: 200},
+		{Name: "p20250109", Description: day(9), Rows: 300},
+		{Name: "p20250110", Description: day(10), Rows: 400},
+		{Name: "p20250111", Description: day(11), Rows: 10},
+		{Name: "pmax", Description: "MAXVALUE"},
+	}
+	plan := p.plan(PartitionKeyUnixTimestamp, partitions, now)
+	if len(plan.Create) != 1 || plan.Create[0].Name != "p20250112" || len(plan.CreateSQLs) != 1 ||
+		!strings.Contains(plan.CreateSQLs[0], "REORGANIZE PARTITION pmax") {
+		t.Errorf("create = %+v %v", plan.Create, plan.CreateSQLs)
+	}
+	if len(plan.Drop) != 2 || plan.Drop[0].Name != "p20250107" || plan.Drop[1].Rows != 200 || !plan.Drop[1].Archive {
+		t.Errorf("drop = %+v", plan.Drop)
+	}
+	if s := plan.String(); !strings.Contains(s, "ALTER TABLE orders DROP PARTITION p20250108;") {
+		t.Errorf("String() = %s", s)
+	}
+}
+
+func TestPartitionStats(t *testing.T) {
+	p := NewPartition(nil, "test", "orders", PartitionUnitDay, 0)
+	day := strconv.FormatInt(time.Date(2025, 1, 11, 0, 0, 0, 0, time.Local).Unix(), 10)
+	stats := p.partitionStats([]partitionStatRow{
+		{Name: "p20250111", Ordinal: 1, Description: day, Rows: 100, DataLength: 16384, IndexLength: 8192},
+		{Name: "pmax", Ordinal: 2, Description: "MAXVALUE"},
+	})
+	want := []PartitionStat{
+		{Table: "orders", Name: "p20250111", Ordinal: 1, Description: day, Bound: time.Date(2025, 1, 11, 0, 0, 0, 0, time.Local),
+			Rows: 100, DataLength: 16384, IndexLength: 8192},
+		{Table: "orders", Name: "pmax", Ordinal: 2, Description: "MAXVALUE"},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("partitionStats() = %+v\nwant %+v", stats, want)
+	}
+	if !stats[1].Bound.IsZero() {
+		t.Errorf("pmax bound = %v, want zero", stats[1].Bound)
+	}
+}
+
+func TestSqlStatsZeroSamples(t *testing.T) {
+	samples := DefaultSqlStatsSamples
+	DefaultSqlStatsSamples = 0
+	defer func() { DefaultSqlStatsSamples = samples }()
+	stats := NewSqlStats()
+	for i := 0; i < 3; i++ {
+		stats.Record("select * from users where id = 1", time.Millisecond*time.Duration(i+1), 1, nil)
+	}
+	top := stats.Top(1)
+	if len(top) != 1 || top[0].Calls != 3 || top[0].MaxTime != time.Millisecond*3 {
+		t.Errorf("top = %+v", top)
+	}
+}
+
+func TestSqlExplainerAcquire(t *testing.T) {
+	e := newSqlExplainer()
+	if e.acquire("select * from users where id = 1") {
+		t.Fatal("acquire before setDB should be false")
+	}
+	e.setDB(newDryRunDB(t, logger.Discard))
+	if e.acquire("update users set name = 'a' where id = 1") {
+		t.Error("non-select should not be explained")
+	}
+	if !e.acquire("select * from users where id = 1") {
+		t.Fatal("first select should be explained")
+	}
+	// 执行中不允许其他EXPLAIN
+	if e.acquire("select * from orders where id = 1") {
+		t.Error("second acquire before release should be false")
+	}
+	e.release()
+	// 同一指纹在间隔内只执行一次
+	if e.acquire("select * from users where id = 2") {
+		t.Error("same fingerprint within interval should be false")
+	}
+	if !e.acquire("select * from orders where id = 1") {
+		t.Error("different fingerprint after release should be true")
+	}
+	e.release()
+}
@@ -5,18 +5,35 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	logger "gorm.io/gorm/logger"
-	"gorm.io/gorm/utils"
 
 	"github.com/itmisx/logx"
 )
 
+// LocalDebug 未指定日志输出模式时，为true则使用控制台输出
+//
+// Deprecated: 使用 Config.LoggerMode 或 WithLoggerMode 指定日志输出模式
 var LocalDebug bool
 
+// LoggerMode 日志输出模式
+type LoggerMode string
+
+const (
+	LoggerModeStructured LoggerMode = "structured" // 结构化输出，通过logx记录
+	LoggerModeConsole    LoggerMode = "console"    // 控制台彩色输出，便于本地调试
+)
+
+// LoggerModeEnv 指定日志输出模式的环境变量，优先级低于 Config.LoggerMode 和 WithLoggerMode
+const LoggerModeEnv = "GORMX_LOGGER_MODE"
+
+// valid 是否为支持的日志输出模式
+func (m LoggerMode) valid() bool {
+	return m == LoggerModeStructured || m == LoggerModeConsole
+}
+
 // Colors
 const (
 	Reset       = "\033[0m"
@@ -35,24 +52,97 @@ const (
 
 type LogLevel int
 
-func init() {
-	filepath.Walk("./", func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() && strings.Contains(info.Name(), "debug_bin") {
-			LocalDebug = true
-		}
-		return nil
-	})
-}
-
 type mylogger struct {
 	logger.Writer
 	logger.Config
 	infoStr, warnStr, errStr            string
 	traceStr, traceErrStr, traceWarnStr string
 	slowSqlHandler                      func(string, int64)
+	stats                               *SqlStats // sql聚合统计
+	explainer                           *sqlExplainer
+	slowSqlExplainHandler               func(string, int64, string)
+	slowSqlEventHandler                 func(SlowSqlEvent)
+	mode                                LoggerMode  // 日志输出模式
+	sampler                             *LogSampler // info级别sql日志采样
+	callerSkipPackages                  []string    // 定位调用位置时跳过的包前缀
+	errorStackDepth                     int         // sql错误日志附带的调用栈层数
 }
 
-func NewLogger(writer logger.Writer, config logger.Config, slowSqlHandler func(string, int64)) logger.Interface {
+// SlowSqlEvent 慢sql事件
+type SlowSqlEvent struct {
+	Ctx          context.Context // 语句的context，可用于关联请求追踪
+	Sql          string          // sql
+	Fingerprint  string          // sql指纹
+	Elapsed      time.Duration   // 耗时
+	Threshold    time.Duration   // 慢sql阈值
+	RowsAffected int64           // 影响行数，-1表示未知
+	Caller       string          // 调用位置
+	Table        string          // 操作的表
+	Target       string          // 执行目标 source/replica
+	Node         string          // 执行节点地址
+	Explain      string          // 执行计划，未开启或获取失败时为空
+
+	rawSql string // 未去除换行符的sql，用于获取执行计划
+}
+
+// LoggerOption 日志记录器可选参数
+type LoggerOption func(*mylogger)
+
+// WithLoggerMode 指定日志输出模式
+func WithLoggerMode(mode LoggerMode) LoggerOption {
+	return func(l *mylogger) {
+		if mode != "" {
+			l.mode = mode
+		}
+	}
+}
+
+// WithCallerSkipPackages 定位调用位置时跳过的包前缀，如业务的repository封装
+// gorm和gormx的调用栈默认跳过
+func WithCallerSkipPackages(prefixes ...string) LoggerOption {
+	return func(l *mylogger) {
+		l.callerSkipPackages = append(l.callerSkipPackages, prefixes...)
+	}
+}
+
+// WithErrorStack sql错误日志附带depth层业务调用栈
+func WithErrorStack(depth int) LoggerOption {
+	return func(l *mylogger) {
+		l.errorStackDepth = depth
+	}
+}
+
+// WithSqlStats 按sql指纹聚合统计
+func WithSqlStats(stats *SqlStats) LoggerOption {
+	return func(l *mylogger) {
+		l.stats = stats
+	}
+}
+
+// WithLogSampler info级别sql日志采样与限流
+func WithLogSampler(sampler *LogSampler) LoggerOption {
+	return func(l *mylogger) {
+		l.sampler = sampler
+	}
+}
+
+// WithSlowSqlExplain 慢sql自动获取执行计划，handler可为nil
+func WithSlowSqlExplain(handler func(sql string, elapsed int64, explain string)) LoggerOption {
+	return func(l *mylogger) {
+		l.explainer = newSqlExplainer()
+		l.slowSqlExplainHandler = handler
+	}
+}
+
+// WithSlowSqlEventHandler 慢sql事件处理器
+// 开启执行计划获取时，事件在执行计划获取完成后异步回调
+func WithSlowSqlEventHandler(handler func(event SlowSqlEvent)) LoggerOption {
+	return func(l *mylogger) {
+		l.slowSqlEventHandler = handler
+	}
+}
+
+func NewLogger(writer logger.Writer, config logger.Config, slowSqlHandler func(string, int64), opts ...LoggerOption) logger.Interface {
 	var (
 		infoStr      = "%s\n[info] "
 		warnStr      = "%s\n[warn] "
@@ -70,7 +160,7 @@ func NewLogger(writer logger.Writer, config logger.Config, slowSqlHandler func(s
 		traceWarnStr = Green + "%s " + Yellow + "%s\n" + Reset + RedBold + "[%.3fms] " + Yellow + "[rows:%v]" + Magenta + " %s" + Reset
 		traceErrStr = RedBold + "%s " + MagentaBold + "%s\n" + Reset + Yellow + "[%.3fms] " + BlueBold + "[rows:%v]" + Reset + " %s"
 	}
-	return &mylogger{
+	l := &mylogger{
 		Writer:         writer,
 		Config:         config,
 		infoStr:        infoStr,
@@ -81,6 +171,54 @@ func NewLogger(writer logger.Writer, config logger.Config, slowSqlHandler func(s
 		traceErrStr:    traceErrStr,
 		slowSqlHandler: slowSqlHandler,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	// 优先级：指定的模式 > 环境变量 > LocalDebug，不支持的模式忽略
+	if l.mode != "" && !l.mode.valid() {
+		logx.Warn(context.Background(), "unsupported logger mode ignored", logx.String("mode", string(l.mode)))
+		l.mode = ""
+	}
+	if l.mode == "" {
+		if mode := LoggerMode(strings.ToLower(os.Getenv(LoggerModeEnv))); mode.valid() {
+			l.mode = mode
+		} else if mode != "" {
+			logx.Warn(context.Background(), "unsupported logger mode ignored", logx.String("mode", string(mode)), logx.String("env", LoggerModeEnv))
+		}
+	}
+	return l
+}
+
+// withContext 使用context中覆盖的日志级别和慢sql阈值
+func (l mylogger) withContext(ctx context.Context) mylogger {
+	if level, ok := LogLevelFromContext(ctx); ok {
+		l.LogLevel = level
+	}
+	if threshold, ok := SlowThresholdFromContext(ctx); ok {
+		l.SlowThreshold = threshold
+	}
+	return l
+}
+
+// caller 获取业务调用位置
+func (l mylogger) caller() string {
+	return fileWithLineNum(l.callerSkipPackages)
+}
+
+// errorStack 获取sql错误日志附带的调用栈
+func (l mylogger) errorStack() []string {
+	if l.errorStackDepth <= 0 {
+		return nil
+	}
+	return shortStack(l.callerSkipPackages, l.errorStackDepth)
+}
+
+// console 是否使用控制台输出
+func (l mylogger) console() bool {
+	if l.mode == "" {
+		return LocalDebug
+	}
+	return l.mode == LoggerModeConsole
 }
 
 // LogMode log mode
@@ -92,9 +230,10 @@ func (l *mylogger) LogMode(level logger.LogLevel) logger.Interface {
 
 // Info print info
 func (l mylogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	l = l.withContext(ctx)
 	if l.LogLevel >= logger.Info {
-		if LocalDebug {
-			l.Printf(l.infoStr+msg, append([]interface{}{utils.FileWithLineNum()}, data...)...)
+		if l.console() {
+			l.Printf(l.infoStr+msg, append([]interface{}{l.caller()}, data...)...)
 		} else {
 			var strs []string
 			for _, s := range data {
@@ -102,16 +241,17 @@ func (l mylogger) Info(ctx context.Context, msg string, data ...interface{}) {
 					strs = append(strs, str)
 				}
 			}
-			logx.Info(ctx, msg, logx.String("line", utils.FileWithLineNum()), logx.StringSlice("detail", strs))
+			logx.Info(ctx, msg, logx.String("line", l.caller()), logx.StringSlice("detail", strs))
 		}
 	}
 }
 
 // Warn print warn messages
 func (l mylogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	l = l.withContext(ctx)
 	if l.LogLevel >= logger.Warn {
-		if LocalDebug {
-			l.Printf(l.warnStr+msg, append([]interface{}{utils.FileWithLineNum()}, data...)...)
+		if l.console() {
+			l.Printf(l.warnStr+msg, append([]interface{}{l.caller()}, data...)...)
 		} else {
 			var strs []string
 			for _, s := range data {
@@ -119,85 +259,121 @@ func (l mylogger) Warn(ctx context.Context, msg string, data ...interface{}) {
 					strs = append(strs, str)
 				}
 			}
-			logx.Info(ctx, msg, logx.String("line", utils.FileWithLineNum()), logx.StringSlice("detail", strs))
+			logx.Info(ctx, msg, logx.String("line", l.caller()), logx.StringSlice("detail", strs))
 		}
 	}
 }
 
 // Error print error messages
 func (l mylogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	l = l.withContext(ctx)
 	if l.LogLevel >= logger.Error {
-		if LocalDebug {
-			l.Printf(l.errStr+msg, append([]interface{}{utils.FileWithLineNum()}, data...)...)
+		if l.console() {
+			l.Printf(l.errStr+msg, append([]interface{}{l.caller()}, data...)...)
 		} else {
-			logx.Info(ctx, msg, logx.String("line", utils.FileWithLineNum()), logx.Any("detail", data))
+			logx.Info(ctx, msg, logx.String("line", l.caller()), logx.Any("detail", data))
 		}
 	}
 }
 
 // Trace print sql message
 func (l mylogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	l = l.withContext(ctx)
+	fc = onceTrace(fc)
+	node := getStmtNode(ctx)
+	// 聚合统计不受日志级别影响
+	if l.stats != nil {
+		sql, rows := fc()
+		l.stats.record(node, sql, elapsed, rows, err)
+	}
+	if detector := NPlusOneDetectorFromContext(ctx); detector != nil {
+		sql, _ := fc()
+		l.detectNPlusOne(ctx, detector, sql)
+	}
 	if l.LogLevel <= logger.Silent {
 		return
 	}
 
-	elapsed := time.Since(begin)
 	switch {
 	case err != nil && l.LogLevel >= logger.Error && (!errors.Is(err, logger.ErrRecordNotFound) || !l.IgnoreRecordNotFoundError):
 		sql, rows := fc()
 		sql = removeEscapeCharacter(sql)
-		if rows == -1 {
-			if LocalDebug {
-				l.Printf(l.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, "-", sql)
+		caller, stack, class := l.caller(), l.errorStack(), ErrorClass(err)
+		if l.console() {
+			errMsg := err.Error()
+			if class != "" {
+				errMsg = "[" + class + "] " + errMsg
+			}
+			if len(stack) > 0 {
+				sql += "\n" + strings.Join(stack, "\n")
+			}
+			if rows == -1 {
+				l.Printf(l.traceErrStr, caller, errMsg, float64(elapsed.Nanoseconds())/1e6, "-", annotateNode(sql, node))
 			} else {
-				logx.Error(ctx,
-					"sql error",
-					logx.String("err", err.Error()),
-					logx.String("line", utils.FileWithLineNum()),
-					logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
-					logx.String("rows affected", "-"),
-					logx.String("sql", sql))
+				l.Printf(l.traceErrStr, caller, errMsg, float64(elapsed.Nanoseconds())/1e6, rows, annotateNode(sql, node))
 			}
 		} else {
-			if LocalDebug {
-				l.Printf(l.traceErrStr, utils.FileWithLineNum(), err, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			fields := []logx.Field{
+				logx.String("err", err.Error()),
+				logx.String("err_class", class),
+				logx.String("line", caller),
+				logx.String("node", node),
+				logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
+			}
+			if rows == -1 {
+				fields = append(fields, logx.String("rows affected", "-"))
 			} else {
-				logx.Error(ctx,
-					"sql error",
-					logx.String("err", err.Error()),
-					logx.String("line", utils.FileWithLineNum()),
-					logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
-					logx.Int64("rows affected", rows),
-					logx.String("sql", sql))
+				fields = append(fields, logx.Int64("rows affected", rows))
 			}
+			fields = append(fields, logx.String("sql", sql))
+			if len(stack) > 0 {
+				fields = append(fields, logx.StringSlice("stack", stack))
+			}
+			logx.Error(ctx, "sql error", fields...)
 		}
 	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= logger.Warn:
-		sql, rows := fc()
-		sql = removeEscapeCharacter(sql)
+		raw, rows := fc()
+		sql := removeEscapeCharacter(raw)
 		slowLog := fmt.Sprintf("SLOW SQL >= %v", l.SlowThreshold)
 		if l.slowSqlHandler != nil {
 			l.slowSqlHandler(sql, int64(float64(elapsed.Nanoseconds())/1e6))
 		}
+		l.handleSlowSql(SlowSqlEvent{
+			Ctx:          ctx,
+			Sql:          sql,
+			Fingerprint:  Fingerprint(raw), // 与SqlStats一致，使用原始sql
+			Elapsed:      elapsed,
+			Threshold:    l.SlowThreshold,
+			RowsAffected: rows,
+			Caller:       l.caller(),
+			Table:        stmtTable(ctx, raw),
+			Target:       getResolverMode(ctx),
+			Node:         node,
+			rawSql:       raw,
+		})
 		if rows == -1 {
-			if LocalDebug {
-				l.Printf(l.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			if l.console() {
+				l.Printf(l.traceWarnStr, l.caller(), slowLog, float64(elapsed.Nanoseconds())/1e6, "-", annotateNode(sql, node))
 			} else {
 				logx.Warn(ctx,
 					"sql warn",
 					logx.String("warn", slowLog),
-					logx.String("line", utils.FileWithLineNum()),
+					logx.String("line", l.caller()),
+					logx.String("node", node),
 					logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
 					logx.String("rows affected", "-"),
 					logx.String("sql", sql))
 			}
 		} else {
-			if LocalDebug {
-				l.Printf(l.traceWarnStr, utils.FileWithLineNum(), slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			if l.console() {
+				l.Printf(l.traceWarnStr, l.caller(), slowLog, float64(elapsed.Nanoseconds())/1e6, rows, annotateNode(sql, node))
 			} else {
 				logx.Warn(ctx,
 					"sql warn",
 					logx.String("warn", slowLog),
-					logx.String("line", utils.FileWithLineNum()),
+					logx.String("line", l.caller()),
+					logx.String("node", node),
 					logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
 					logx.Int64("rows affected", rows),
 					logx.String("sql", sql))
@@ -206,24 +382,34 @@ func (l mylogger) Trace(ctx context.Context, begin time.Time, fc func() (string,
 	case l.LogLevel == logger.Info:
 		sql, rows := fc()
 		sql = removeEscapeCharacter(sql)
+		// 通过ContextWithLogLevel覆盖日志级别时不采样
+		_, override := LogLevelFromContext(ctx)
+		allowed := override || l.sampler.Allow(sql)
+		// 被抑制的条数在之后的任一info日志时输出，不依赖再次抑制
+		l.reportSuppressed(ctx)
+		if !allowed {
+			return
+		}
 		if rows == -1 {
-			if LocalDebug {
-				l.Printf(l.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, "-", sql)
+			if l.console() {
+				l.Printf(l.traceStr, l.caller(), float64(elapsed.Nanoseconds())/1e6, "-", annotateNode(sql, node))
 			} else {
 				logx.Info(ctx,
 					"sql info",
-					logx.String("line", utils.FileWithLineNum()),
+					logx.String("line", l.caller()),
+					logx.String("node", node),
 					logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
 					logx.String("rows affected", "-"),
 					logx.String("sql", sql))
 			}
 		} else {
-			if LocalDebug {
-				l.Printf(l.traceStr, utils.FileWithLineNum(), float64(elapsed.Nanoseconds())/1e6, rows, sql)
+			if l.console() {
+				l.Printf(l.traceStr, l.caller(), float64(elapsed.Nanoseconds())/1e6, rows, annotateNode(sql, node))
 			} else {
 				logx.Info(ctx,
 					"sql info",
-					logx.String("line", utils.FileWithLineNum()),
+					logx.String("line", l.caller()),
+					logx.String("node", node),
 					logx.Float64("elapsed[ms]", float64(elapsed.Nanoseconds())/1e6),
 					logx.Int64("rows affected", rows),
 					logx.String("sql", sql))
@@ -232,6 +418,124 @@ func (l mylogger) Trace(ctx context.Context, begin time.Time, fc func() (string,
 	}
 }
 
+// detectNPlusOne N+1查询检测，同一指纹首次超过阈值时告警
+func (l mylogger) detectNPlusOne(ctx context.Context, detector *NPlusOneDetector, sql string) {
+	fp := Fingerprint(sql)
+	if !strings.HasPrefix(fp, "select") {
+		return
+	}
+	report, exceeded := detector.record(fp, l.caller())
+	if !exceeded || l.LogLevel < logger.Warn {
+		return
+	}
+	if l.console() {
+		l.Printf(l.warnStr+"N+1 QUERY >= %d: %s\n%s", l.caller(), report.Count, fp, strings.Join(report.CallerList(), "\n"))
+	} else {
+		logx.Warn(ctx,
+			"sql n+1 query",
+			logx.String("line", l.caller()),
+			logx.Int("count", report.Count),
+			logx.String("fingerprint", fp),
+			logx.StringSlice("callers", report.CallerList()))
+	}
+}
+
+// reportSuppressed 定期输出被采样抑制的日志条数
+func (l mylogger) reportSuppressed(ctx context.Context) {
+	n := l.sampler.report()
+	if n == 0 {
+		return
+	}
+	msg := fmt.Sprintf("%d sql info logs suppressed in the last %v", n, DefaultSuppressedReportInterval)
+	if l.console() {
+		l.Printf(l.infoStr+msg, l.caller())
+	} else {
+		logx.Info(ctx, "sql info suppressed", logx.Int64("suppressed", n), logx.Int64("total_suppressed", l.sampler.Suppressed()))
+	}
+}
+
+// handleSlowSql 慢sql事件处理，开启执行计划获取时异步获取执行计划后再回调
+func (l mylogger) handleSlowSql(event SlowSqlEvent) {
+	if l.explainer == nil || !l.explainer.acquire(event.rawSql) {
+		l.emitSlowSqlEvent(event)
+		return
+	}
+	// 异步执行，避免阻塞业务
+	go func() {
+		defer l.explainer.release()
+		ctx := event.Ctx
+		plan, err := l.explainer.explain(context.WithoutCancel(ctx), event.rawSql)
+		if err != nil {
+			if l.console() {
+				l.Printf(l.warnStr+"explain slow sql failed: %v", event.Caller, err)
+			} else {
+				logx.Warn(ctx, "explain slow sql failed", logx.Err(err), logx.String("sql", event.Sql))
+			}
+		} else {
+			if l.console() {
+				l.Printf(l.warnStr+"%s\n%s", event.Caller, event.Sql, plan)
+			} else {
+				logx.Warn(ctx,
+					"sql explain",
+					logx.String("line", event.Caller),
+					logx.Float64("elapsed[ms]", float64(event.Elapsed.Nanoseconds())/1e6),
+					logx.String("sql", event.Sql),
+					logx.String("explain", plan))
+			}
+		}
+		event.Explain = plan
+		l.emitSlowSqlEvent(event)
+	}()
+}
+
+// emitSlowSqlEvent 回调慢sql处理器
+func (l mylogger) emitSlowSqlEvent(event SlowSqlEvent) {
+	if l.slowSqlExplainHandler != nil {
+		l.slowSqlExplainHandler(event.Sql, event.Elapsed.Milliseconds(), event.Explain)
+	}
+	if l.slowSqlEventHandler != nil {
+		l.slowSqlEventHandler(event)
+	}
+}
+
+// stmtTable 获取语句操作的表
+func stmtTable(ctx context.Context, sql string) string {
+	if trace := getStmtTrace(ctx); trace != nil && trace.Table != "" {
+		return trace.Table
+	}
+	return fingerprintTable(Fingerprint(sql))
+}
+
+// annotateNode 控制台输出时在sql前标注执行节点
+// dbresolver追踪模式的前缀 [replica] select ... => [replica 127.0.0.1:3306] select ...
+func annotateNode(sql string, node string) string {
+	if node == "" {
+		return sql
+	}
+	if strings.HasPrefix(sql, "[") {
+		if i := strings.Index(sql, "] "); i > 0 {
+			return sql[:i] + " " + node + sql[i:]
+		}
+	}
+	return "[" + node + "] " + sql
+}
+
+// onceTrace 保证sql只生成一次
+func onceTrace(fc func() (string, int64)) func() (string, int64) {
+	var (
+		done bool
+		sql  string
+		rows int64
+	)
+	return func() (string, int64) {
+		if !done {
+			sql, rows = fc()
+			done = true
+		}
+		return sql, rows
+	}
+}
+
 // 去除转义字符
 func removeEscapeCharacter(sql string) string {
 	// remove \r
@@ -0,0 +1,130 @@
+package gormx
+
+// N+1查询检测
+// 在一个请求的context内按sql指纹统计select的执行次数，同一指纹超过阈值时输出告警及调用位置
+// 建议仅在调试模式下由中间件挂载到请求的context
+//
+// ctx, detector := gormx.ContextWithNPlusOneDetector(ctx, 10)
+// ...
+// // 测试中可直接断言
+// if err := detector.Err(); err != nil {
+// 	t.Fatal(err)
+// }
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NPlusOneReport N+1查询报告
+type NPlusOneReport struct {
+	Fingerprint string         // sql指纹
+	Count       int            // 执行次数
+	Callers     map[string]int // 调用位置及次数
+}
+
+// NPlusOneDetector N+1查询检测器
+type NPlusOneDetector struct {
+	threshold int // 同一指纹允许的最大执行次数
+	mu        sync.Mutex
+	entries   map[string]*NPlusOneReport
+}
+
+type nPlusOneDetectorKey struct{}
+
+// ContextWithNPlusOneDetector 挂载N+1查询检测器，同一sql指纹执行超过threshold次时告警
+func ContextWithNPlusOneDetector(ctx context.Context, threshold int) (context.Context, *NPlusOneDetector) {
+	detector := &NPlusOneDetector{
+		threshold: threshold,
+		entries:   make(map[string]*NPlusOneReport),
+	}
+	return context.WithValue(ctx, nPlusOneDetectorKey{}, detector), detector
+}
+
+// NPlusOneDetectorFromContext 获取context中的N+1查询检测器
+func NPlusOneDetectorFromContext(ctx context.Context) *NPlusOneDetector {
+	if ctx == nil {
+		return nil
+	}
+	detector, _ := ctx.Value(nPlusOneDetectorKey{}).(*NPlusOneDetector)
+	return detector
+}
+
+// record 记录一次查询，首次超过阈值时返回true
+func (d *NPlusOneDetector) record(fp string, caller string) (NPlusOneReport, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[fp]
+	if !ok {
+		entry = &NPlusOneReport{Fingerprint: fp, Callers: make(map[string]int)}
+		d.entries[fp] = entry
+	}
+	entry.Count++
+	entry.Callers[caller]++
+	if entry.Count == d.threshold+1 {
+		return entry.copy(), true
+	}
+	return NPlusOneReport{}, false
+}
+
+// Reports 获取超过阈值的查询报告，按执行次数降序
+func (d *NPlusOneDetector) Reports() []NPlusOneReport {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	var reports []NPlusOneReport
+	for _, entry := range d.entries {
+		if entry.Count > d.threshold {
+			reports = append(reports, entry.copy())
+		}
+	}
+	d.mu.Unlock()
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Count > reports[j].Count })
+	return reports
+}
+
+// Err 存在超过阈值的查询时返回错误，便于在测试中断言
+func (d *NPlusOneDetector) Err() error {
+	reports := d.Reports()
+	if len(reports) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	for _, report := range reports {
+		fmt.Fprintf(&b, "\n%dx %s", report.Count, report.Fingerprint)
+		for _, caller := range report.CallerList() {
+			fmt.Fprintf(&b, "\n\t%s", caller)
+		}
+	}
+	return fmt.Errorf("n+1 queries detected (threshold %d):%s", d.threshold, b.String())
+}
+
+// CallerList 调用位置列表，按次数降序，格式为 file:line (次数)
+func (r NPlusOneReport) CallerList() []string {
+	callers := make([]string, 0, len(r.Callers))
+	for caller := range r.Callers {
+		callers = append(callers, caller)
+	}
+	sort.Slice(callers, func(i, j int) bool {
+		if r.Callers[callers[i]] != r.Callers[callers[j]] {
+			return r.Callers[callers[i]] > r.Callers[callers[j]]
+		}
+		return callers[i] < callers[j]
+	})
+	for i, caller := range callers {
+		callers[i] = fmt.Sprintf("%s (%d)", caller, r.Callers[caller])
+	}
+	return callers
+}
+
+func (r *NPlusOneReport) copy() NPlusOneReport {
+	callers := make(map[string]int, len(r.Callers))
+	for k, v := range r.Callers {
+		callers[k] = v
+	}
+	return NPlusOneReport{Fingerprint: r.Fingerprint, Count: r.Count, Callers: callers}
+}
@@ -14,31 +14,52 @@ package gormx
 //   PARTITION p20250301 VALUES LESS THAN (UNIX_TIMESTAMP('2025-03-01')),
 //   PARTITION p20250401 VALUES LESS THAN (UNIX_TIMESTAMP('2025-04-01')),
 //   PARTITION p20250501 VALUES LESS THAN (UNIX_TIMESTAMP('2025-05-01')),
-//   PARTITION p20250601 VALUES LESS THAN (UNIX_TIMESTAMP('2025-06-01'))
-//   PARTITION pmax VALUES LESS THAN MAXVALUE  // !!! 如果需要动态新增分区，该语句需要去掉，否则会报错，这是个兜底，不能再加分区
+//   PARTITION p20250601 VALUES LESS THAN (UNIX_TIMESTAMP('2025-06-01')),
+//   PARTITION pmax VALUES LESS THAN MAXVALUE  // 可选的兜底分区，存在时通过 REORGANIZE PARTITION pmax INTO (...) 拆分出新的分区
 // );
 //
-// &partition.Start() 会自动启动一个协程，定期自动创建分区和移除过期分区
+// 同样支持 PARTITION BY RANGE COLUMNS(created_date) 的DATE/DATETIME列，及 PARTITION BY RANGE(TO_DAYS(created_date))
+// 分区键类型默认从information_schema检测，也可通过WithPartitionKeyType指定
+//
+// partition.Start(ctx) 会同步创建分区，并启动一个协程归档及移除过期分区，之后定期检查，ctx结束或调用Stop()后停止
+// partition.RunOnce(ctx) 手动执行一次创建分区和移除过期分区
 
 import (
 	"context"
+	"crypto/md5"
+	"database/sql"
+	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/dromara/carbon/v2"
 	"github.com/itmisx/logx"
-	"github.com/samber/lo"
 	"gorm.io/gorm"
 )
 
-type partition struct {
-	db                *gorm.DB       // *gorm.DB
-	database          string         // 数据库名
-	table             string         // 表名
-	partitionUnit     PartitionUnitT // 分区单位 1-按天 2-按月
-	retentionDuration time.Duration  // 分区数据的保留时长
+// Partition 分区管理
+type Partition struct {
+	db                *gorm.DB          // *gorm.DB
+	database          string            // 数据库名
+	table             string            // 表名
+	partitionUnit     PartitionUnitT    // 分区单位 1-按天 2-按月 3-按年 4-按小时 5-按周
+	retentionDuration time.Duration     // 分区数据的保留时长
+	horizon           int               // 当前周期之后预创建的分区数
+	keyType           PartitionKeyT     // 分区键类型，默认从information_schema检测
+	keyEncoding       KeyEncoding       // 时间戳分区键的编码，默认使用UNIX_TIMESTAMP(秒)
+	archiver          PartitionArchiver // 删除过期分区前的归档
+	lock              bool              // 是否通过GET_LOCK保证同一时间只有一个实例执行分区维护
+	location          *time.Location    // 分区边界的时区，指定后时间戳分区键使用显式的时间戳作为分区上界
+
+	statsHandler   func(ctx context.Context, stats []PartitionStat) // 每次检查后的分区统计回调
+	archiveTimeout time.Duration                                    // 归档及删除过期分区的超时时间
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // 停止定时检查
+	done   chan struct{}      // 定时检查协程已退出
 }
 
 type PartitionUnitT int // 分区单元
@@ -47,205 +68,606 @@ const (
 	PartitionUnitDay   PartitionUnitT = iota + 1 // 按天分区
 	PartitionUnitMonth                           // 按月分区
 	PartitionUnitYear                            // 按年分区
+	PartitionUnitHour                            // 按小时分区
+	PartitionUnitWeek                            // 按周(ISO周，周一开始)分区
+)
+
+type PartitionKeyT int // 分区键类型
+
+const (
+	PartitionKeyAuto          PartitionKeyT = iota // 从information_schema检测
+	PartitionKeyUnixTimestamp                      // RANGE(col)，col为秒级时间戳，或RANGE(UNIX_TIMESTAMP(col))
+	PartitionKeyColumns                            // RANGE COLUMNS(col)，col为DATE/DATETIME
+	PartitionKeyToDays                             // RANGE(TO_DAYS(col))
+)
+
+// KeyEncoding 时间戳分区键的编码，将时间转换为分区键的值，用于生成分区上界及判断分区过期
+type KeyEncoding func(t time.Time) int64
+
+var (
+	KeyEncodingSeconds      KeyEncoding = func(t time.Time) int64 { return t.Unix() }      // 秒
+	KeyEncodingMilliseconds KeyEncoding = func(t time.Time) int64 { return t.UnixMilli() } // 毫秒，如autoCreateTime:milli
+	KeyEncodingMicroseconds KeyEncoding = func(t time.Time) int64 { return t.UnixMicro() } // 微秒
 )
 
 // 默认分区自动检查时间
 var DefaultCronDuration = time.Hour
 
+// 默认当前周期之后预创建的分区数
+var DefaultPartitionHorizon = 1
+
+// 定时检查中创建分区的超时时间
+var DefaultPartitionTimeout = time.Second * 30
+
+// 默认归档及删除过期分区的超时时间，归档大分区耗时较长，不受创建分区的超时限制
+var DefaultPartitionArchiveTimeout = time.Hour
+
+var (
+	// ErrUnsupportedPartitionUnit 不支持的分区单位
+	ErrUnsupportedPartitionUnit = errors.New("unsupported partition unit type")
+	// ErrPartitionStarted 分区自动管理已启动
+	ErrPartitionStarted = errors.New("partition already started")
+	// ErrPartitionLocked 其他实例正在执行分区维护
+	ErrPartitionLocked = errors.New("partition maintenance is running on another instance")
+	// ErrPartitionUnitMismatch 分区单位与分区键类型不匹配，如按小时分区使用TO_DAYS
+	ErrPartitionUnitMismatch = errors.New("partition unit does not match partition key type")
+	// ErrUnsupportedPartitionKey 不支持的分区方式
+	ErrUnsupportedPartitionKey = errors.New("unsupported partition key type")
+)
+
 func NewPartition(
 	db *gorm.DB,
 	database string,
 	table string,
 	partitionUnit PartitionUnitT, // 分区单位
 	retentionDuration time.Duration, // 数据保留时间
-) *partition {
-	return &partition{
+	opts ...PartitionOption,
+) *Partition {
+	p := &Partition{
 		db:                db,
 		database:          database,
 		table:             table,
 		partitionUnit:     partitionUnit,
 		retentionDuration: retentionDuration,
+		horizon:           DefaultPartitionHorizon,
+		lock:              true,
+		archiveTimeout:    DefaultPartitionArchiveTimeout,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// PartitionOption 分区管理选项
+type PartitionOption func(*Partition)
+
+// WithPartitionKeyType 指定分区键类型，不指定时从information_schema检测
+func WithPartitionKeyType(keyType PartitionKeyT) PartitionOption {
+	return func(p *Partition) {
+		p.keyType = keyType
+	}
+}
+
+// WithPartitionKeyEncoding 时间戳分区键的编码，如毫秒、微秒或自定义函数
+// 指定后分区上界直接使用编码后的值，如 VALUES LESS THAN (1735660800000)
+func WithPartitionKeyEncoding(encoding KeyEncoding) PartitionOption {
+	return func(p *Partition) {
+		p.keyEncoding = encoding
+	}
+}
+
+// WithPartitionArchiver 删除过期分区前先归档，归档校验通过后才删除分区
+func WithPartitionArchiver(archiver PartitionArchiver) PartitionOption {
+	return func(p *Partition) {
+		p.archiver = archiver
+	}
+}
+
+// WithPartitionArchiveTimeout 归档及删除过期分区的超时时间，默认DefaultPartitionArchiveTimeout，<=0表示不限制
+func WithPartitionArchiveTimeout(timeout time.Duration) PartitionOption {
+	return func(p *Partition) {
+		p.archiveTimeout = timeout
+	}
+}
+
+// WithPartitionLock 是否通过GET_LOCK保证同一时间只有一个实例执行分区维护，默认开启
+// 多个实例同时调用Start时，只有获取到锁的实例执行ADD/DROP PARTITION，避免元数据锁堆积及重复创建分区
+func WithPartitionLock(enabled bool) PartitionOption {
+	return func(p *Partition) {
+		p.lock = enabled
+	}
+}
+
+// WithPartitionLocation 分区边界的时区，默认为进程的本地时区
+// 指定后时间戳分区键的分区上界为按该时区计算的显式时间戳，如 VALUES LESS THAN (1735660800)，
+// 不再依赖mysql会话的time_zone
+func WithPartitionLocation(location *time.Location) PartitionOption {
+	return func(p *Partition) {
+		p.location = location
+	}
+}
+
+// WithPartitionHorizon 当前周期之后预创建的分区数，如按天分区时14表示预创建未来14天的分区
+func WithPartitionHorizon(n int) PartitionOption {
+	return func(p *Partition) {
+		if n >= 0 {
+			p.horizon = n
+		}
 	}
 }
 
-// List 获取所有分区
-func (p *partition) list(ctx context.Context) (partitions []string, err error) {
-	// 获取所有分区
+// partitionInfo 分区信息
+type partitionInfo struct {
+	Name        string // 分区名
+	Description string // 分区上界的值，如 1735660800、'2025-01-01'、MAXVALUE
+	Rows        int64  // 估计行数
+}
+
+// describe 获取所有分区及其上界
+func (p *Partition) describe(ctx context.Context) (partitions []partitionInfo, err error) {
 	err = p.db.WithContext(ctx).Table("information_schema.PARTITIONS").
+		Select("PARTITION_NAME AS name, PARTITION_DESCRIPTION AS description, TABLE_ROWS AS `rows`").
 		Where("TABLE_SCHEMA = ?", p.database).
 		Where("TABLE_NAME = ?", p.table).
 		Where("PARTITION_NAME IS NOT NULL").
-		Pluck("PARTITION_NAME", &partitions).
+		Order("PARTITION_ORDINAL_POSITION").
+		Scan(&partitions).
 		Error
 	return partitions, err
 }
 
-// ExistsDayPartition 是否存在日分区
-func (p *partition) existsDayPartition(ctx context.Context, days int) (bool, error) {
-	partitions, err := p.list(ctx)
+// detectKeyType 从information_schema检测分区键类型
+func (p *Partition) detectKeyType(ctx context.Context) (PartitionKeyT, error) {
+	if p.keyType != PartitionKeyAuto {
+		return p.keyType, nil
+	}
+	var info struct {
+		PartitionMethod     string
+		PartitionExpression string
+	}
+	err := p.db.WithContext(ctx).Table("information_schema.PARTITIONS").
+		Select("PARTITION_METHOD AS partition_method, PARTITION_EXPRESSION AS partition_expression").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("PARTITION_NAME IS NOT NULL").
+		Limit(1).
+		Scan(&info).
+		Error
 	if err != nil {
-		return false, err
+		return PartitionKeyAuto, err
 	}
-	partitionName := "p" + strings.ReplaceAll(carbon.Now().AddDays(days).StartOfDay().ToDateString(), "-", "")
-	return lo.Contains(partitions, partitionName), nil
+	return parsePartitionKeyType(info.PartitionMethod, info.PartitionExpression)
 }
 
-// ExistsMonthPartition 是否存在月分区
-func (p *partition) existsMonthPartition(ctx context.Context, months int) (bool, error) {
-	partitions, err := p.list(ctx)
-	if err != nil {
-		return false, err
+// validateUnit 校验分区单位及其与分区键类型是否匹配，dataType为分区列类型
+// TO_DAYS及DATE列的精度为天，不支持按小时分区
+func (p *Partition) validateUnit(keyType PartitionKeyT, dataType string) error {
+	switch p.partitionUnit {
+	case PartitionUnitDay, PartitionUnitMonth, PartitionUnitYear, PartitionUnitWeek:
+		return nil
+	case PartitionUnitHour:
+	default:
+		return ErrUnsupportedPartitionUnit
+	}
+	switch {
+	case keyType == PartitionKeyToDays:
+		return fmt.Errorf("%w: hour partition of table %s with TO_DAYS", ErrPartitionUnitMismatch, p.table)
+	case keyType == PartitionKeyColumns && dataType == "date":
+		return fmt.Errorf("%w: hour partition of table %s on DATE column", ErrPartitionUnitMismatch, p.table)
 	}
-	partitionName := "p" + strings.ReplaceAll(carbon.Now().AddMonths(months).StartOfMonth().ToDateString(), "-", "")
-	return lo.Contains(partitions, partitionName), nil
+	return nil
 }
 
-// ExistsYearPartition 是否存在年分区
-func (p *partition) existsYearPartition(ctx context.Context, years int) (bool, error) {
-	partitions, err := p.list(ctx)
-	if err != nil {
-		return false, err
+// columnDataType 获取分区列的类型，RANGE COLUMNS分区按小时分区时用于校验
+func (p *Partition) columnDataType(ctx context.Context) (string, error) {
+	var expression string
+	db := p.db.WithContext(ctx)
+	err := db.Table("information_schema.PARTITIONS").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("PARTITION_NAME IS NOT NULL").
+		Limit(1).
+		Pluck("PARTITION_EXPRESSION", &expression).
+		Error
+	if err != nil || expression == "" {
+		return "", err
 	}
-	partitionName := "p" + strings.ReplaceAll(carbon.Now().AddYears(years).StartOfYear().ToDateString(), "-", "")
-	return lo.Contains(partitions, partitionName), nil
+	var dataType string
+	err = db.Table("information_schema.COLUMNS").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("COLUMN_NAME = ?", strings.Trim(expression, "`")).
+		Limit(1).
+		Pluck("DATA_TYPE", &dataType).
+		Error
+	return strings.ToLower(dataType), err
 }
 
-// AddDayPartition 新增日分区
-func (p *partition) addDayPartition(ctx context.Context, days int) error {
-	exists, err := p.existsDayPartition(ctx, days)
-	if err != nil {
-		return err
+// parsePartitionKeyType 根据分区方式和分区表达式判断分区键类型
+// RANGE仅支持直接使用时间戳列、UNIX_TIMESTAMP(col)、TO_DAYS(col)，其他表达式(如YEAR(col))无法生成正确的分区上界
+func parsePartitionKeyType(method string, expression string) (PartitionKeyT, error) {
+	expr := strings.ToLower(strings.TrimSpace(expression))
+	switch strings.ToUpper(method) {
+	case "RANGE COLUMNS":
+		if partitionColumnPattern.MatchString(expr) {
+			return PartitionKeyColumns, nil
+		}
+	case "RANGE":
+		switch {
+		case partitionColumnPattern.MatchString(expr):
+			return PartitionKeyUnixTimestamp, nil
+		case partitionFuncArg(expr, "unix_timestamp"):
+			return PartitionKeyUnixTimestamp, nil
+		case partitionFuncArg(expr, "to_days"):
+			return PartitionKeyToDays, nil
+		}
 	}
-	if exists {
-		return nil
+	return PartitionKeyAuto, fmt.Errorf("%w: %s %s", ErrUnsupportedPartitionKey, method, expression)
+}
+
+// 分区表达式为单个列
+var partitionColumnPattern = regexp.MustCompile("^`?[a-z0-9_$]+`?$")
+
+// partitionFuncArg 分区表达式是否为 fn(col)
+func partitionFuncArg(expr string, fn string) bool {
+	arg, ok := strings.CutPrefix(expr, fn+"(")
+	if !ok {
+		return false
 	}
-	partitionName := "p" + strings.ReplaceAll(carbon.Now().AddDays(days).StartOfDay().ToDateString(), "-", "")
-	partitionRange := carbon.Now().AddDays(days).StartOfDay().ToDateString()
-	createPartitionSQL := fmt.Sprintf(
-		"ALTER TABLE %s ADD PARTITION(PARTITION %s VALUES LESS THAN (UNIX_TIMESTAMP('%s')))",
-		p.table,
-		partitionName,
-		partitionRange,
-	)
-	return p.db.WithContext(ctx).Exec(createPartitionSQL).Error
+	arg, ok = strings.CutSuffix(arg, ")")
+	return ok && partitionColumnPattern.MatchString(strings.TrimSpace(arg))
 }
 
-// AddMonthPartition 新增月分区
-func (p *partition) addMonthPartition(ctx context.Context, months int) error {
-	exists, err := p.existsMonthPartition(ctx, months)
-	if err != nil {
-		return err
+// rangeValue 分区上界的取值表达式
+func (p *Partition) rangeValue(keyType PartitionKeyT, bound time.Time) string {
+	value := bound.Format(time.DateOnly)
+	if !bound.Equal(time.Date(bound.Year(), bound.Month(), bound.Day(), 0, 0, 0, 0, bound.Location())) {
+		value = bound.Format(time.DateTime)
 	}
-	if exists {
-		return nil
+	switch keyType {
+	case PartitionKeyColumns:
+		return fmt.Sprintf("'%s'", value)
+	case PartitionKeyToDays:
+		return fmt.Sprintf("TO_DAYS('%s')", value)
+	default:
+		if p.keyEncoding != nil {
+			return strconv.FormatInt(p.keyEncoding(bound), 10)
+		}
+		if p.location != nil {
+			return strconv.FormatInt(bound.Unix(), 10)
+		}
+		return fmt.Sprintf("UNIX_TIMESTAMP('%s')", value)
 	}
-	partitionName := "p" + strings.ReplaceAll(carbon.Now().AddMonths(months).StartOfMonth().ToDateString(), "-", "")
-	partitionRange := carbon.Now().AddMonths(months).StartOfMonth().ToDateString()
-	createPartitionSQL := fmt.Sprintf(
-		"ALTER TABLE %s ADD PARTITION(PARTITION %s VALUES LESS THAN (UNIX_TIMESTAMP('%s')))",
-		p.table,
-		partitionName,
-		partitionRange,
-	)
-	return p.db.WithContext(ctx).Exec(createPartitionSQL).Error
 }
 
-// AddYearPartition 新增年分区
-func (p *partition) addYearPartition(ctx context.Context, years int) error {
-	exists, err := p.existsYearPartition(ctx, years)
-	if err != nil {
-		return err
+// expired 分区是否已过期，即分区上界不晚于earliest
+// 时间戳分区键按编码后的分区上界判断，其他按分区名判断
+func (p *Partition) expired(keyType PartitionKeyT, partition partitionInfo, earliest time.Time) bool {
+	if keyType == PartitionKeyUnixTimestamp {
+		value, err := strconv.ParseInt(partition.Description, 10, 64)
+		if err != nil {
+			// MAXVALUE
+			return false
+		}
+		encoding := p.keyEncoding
+		if encoding == nil {
+			encoding = KeyEncodingSeconds
+		}
+		return value <= encoding(earliest)
+	}
+	bound, ok := p.parsePartitionName(partition.Name)
+	return ok && !bound.After(earliest)
+}
+
+// loc 分区边界的时区
+func (p *Partition) loc() *time.Location {
+	if p.location != nil {
+		return p.location
 	}
-	if exists {
+	return time.Local
+}
+
+// now 分区边界时区的当前时间
+func (p *Partition) now() time.Time {
+	return time.Now().In(p.loc())
+}
+
+// partitionName 分区名，以分区上界命名
+// 按小时 p2025010113，按周 p2025w05(ISO年及周数)，其他 p20250101
+func (p *Partition) partitionName(bound time.Time) string {
+	switch p.partitionUnit {
+	case PartitionUnitHour:
+		return "p" + bound.Format("2006010215")
+	case PartitionUnitWeek:
+		year, week := bound.ISOWeek()
+		return fmt.Sprintf("p%04dw%02d", year, week)
+	default:
+		return "p" + bound.Format("20060102")
+	}
+}
+
+// parsePartitionName 解析分区名对应的分区上界，非该命名规则的分区(如pmax)返回false
+func (p *Partition) parsePartitionName(name string) (time.Time, bool) {
+	name = strings.TrimPrefix(name, "p")
+	switch p.partitionUnit {
+	case PartitionUnitHour:
+		bound, err := time.ParseInLocation("2006010215", name, p.loc())
+		return bound, err == nil
+	case PartitionUnitWeek:
+		var year, week int
+		if n, err := fmt.Sscanf(name, "%4dw%2d", &year, &week); err != nil || n != 2 || week < 1 || week > 53 {
+			return time.Time{}, false
+		}
+		// 1月4日所在的周为ISO第1周
+		jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, p.loc())
+		bound := p.periodStart(jan4, week-1)
+		return bound, p.partitionName(bound) == "p"+name
+	default:
+		bound, err := time.ParseInLocation("20060102", name, p.loc())
+		return bound, err == nil
+	}
+}
+
+// periodStart 获取t所在周期偏移offset个周期后的起始时间
+func (p *Partition) periodStart(t time.Time, offset int) time.Time {
+	switch p.partitionUnit {
+	case PartitionUnitHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+offset, 0, 0, 0, t.Location())
+	case PartitionUnitWeek:
+		// 周一为一周的开始
+		weekday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-weekday+offset*7, 0, 0, 0, 0, t.Location())
+	case PartitionUnitMonth:
+		return time.Date(t.Year(), t.Month()+time.Month(offset), 1, 0, 0, 0, 0, t.Location())
+	case PartitionUnitYear:
+		return time.Date(t.Year()+offset, 1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// pendingBounds 计算需要创建的分区上界，按时间升序
+// 当前周期的分区上界为下一周期的起始时间，需覆盖到当前周期之后horizon个周期，
+// 并补齐最新分区与当前周期之间因停机等原因缺失的分区
+func (p *Partition) pendingBounds(partitions []string, now time.Time) []time.Time {
+	target := p.periodStart(now, p.horizon+1)
+	next := p.periodStart(now, 1)
+	var latest time.Time
+	for _, name := range partitions {
+		if bound, ok := p.parsePartitionName(name); ok && bound.After(latest) {
+			latest = bound
+		}
+	}
+	if !latest.IsZero() && latest.Before(next) {
+		next = p.periodStart(latest, 1)
+	}
+	var bounds []time.Time
+	for ; !next.After(target); next = p.periodStart(next, 1) {
+		if next.After(latest) {
+			bounds = append(bounds, next)
+		}
+	}
+	return bounds
+}
+
+// addPartitionSQLs 新增分区的sql
+// 存在MAXVALUE兜底分区时无法ADD PARTITION，通过REORGANIZE从兜底分区拆分出新的分区，兜底分区保持在最后
+func (p *Partition) addPartitionSQLs(keyType PartitionKeyT, bounds []time.Time, maxValuePartition string) []string {
+	if len(bounds) == 0 {
 		return nil
 	}
-	partitionName := "p" + strings.ReplaceAll(carbon.Now().AddYears(years).StartOfYear().ToDateString(), "-", "")
-	partitionRange := carbon.Now().AddYears(years).StartOfYear().ToDateString()
-	sql := fmt.Sprintf(
-		"ALTER TABLE %s ADD PARTITION(PARTITION %s VALUES LESS THAN (UNIX_TIMESTAMP('%s')))",
+	if maxValuePartition == "" {
+		sqls := make([]string, 0, len(bounds))
+		for _, bound := range bounds {
+			sqls = append(sqls, fmt.Sprintf(
+				"ALTER TABLE %s ADD PARTITION(PARTITION %s VALUES LESS THAN (%s))",
+				p.table,
+				p.partitionName(bound),
+				p.rangeValue(keyType, bound),
+			))
+		}
+		return sqls
+	}
+	definitions := make([]string, 0, len(bounds)+1)
+	for _, bound := range bounds {
+		definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN (%s)", p.partitionName(bound), p.rangeValue(keyType, bound)))
+	}
+	definitions = append(definitions, fmt.Sprintf("PARTITION %s VALUES LESS THAN MAXVALUE", maxValuePartition))
+	return []string{fmt.Sprintf(
+		"ALTER TABLE %s REORGANIZE PARTITION %s INTO (%s)",
 		p.table,
-		partitionName,
-		partitionRange,
-	)
-	return p.db.WithContext(ctx).Exec(sql).Error
+		maxValuePartition,
+		strings.Join(definitions, ", "),
+	)}
 }
 
-// dropExpiredPartitions 删除过期分区
-func (p *partition) dropExpiredPartitions(ctx context.Context) (err error) {
-	if p.retentionDuration <= 0 {
-		return nil
+// earliestBound 未过期分区的最早上界，分区上界不晚于保留时长之前的当天零点(按小时分区为整点)，则分区内数据均已过期
+func (p *Partition) earliestBound(now time.Time) time.Time {
+	expired := now.Add(-p.retentionDuration)
+	if p.partitionUnit == PartitionUnitHour {
+		return p.periodStart(expired, 0)
+	}
+	return time.Date(expired.Year(), expired.Month(), expired.Day(), 0, 0, 0, 0, expired.Location())
+}
+
+// dropExpiredPartitions 删除过期分区，单个分区删除失败不影响其他分区
+func (p *Partition) dropExpiredPartitions(ctx context.Context, plan *PartitionPlan) error {
+	var errs []error
+	for _, partition := range plan.Drop {
+		if partition.Archive {
+			if err := p.archiver.Archive(ctx, p.db, p.table, partition.Name); err != nil {
+				errs = append(errs, fmt.Errorf("archive table %s partition %s: %w", p.table, partition.Name, err))
+				continue
+			}
+			logx.Info(ctx, "partition archived", logx.String("table", p.table), logx.String("partition", partition.Name))
+		}
+		if err := p.db.WithContext(ctx).Exec(partition.SQL).Error; err != nil {
+			errs = append(errs, fmt.Errorf("drop table %s partition %s: %w", p.table, partition.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// addPartitions 创建当前周期及未来的分区，并补齐缺失的分区
+func (p *Partition) addPartitions(ctx context.Context, plan *PartitionPlan) error {
+	for _, sql := range plan.CreateSQLs {
+		// 分区上界需递增，前一个分区创建失败时后续分区无法创建
+		if err := p.db.WithContext(ctx).Exec(sql).Error; err != nil {
+			return fmt.Errorf("add table %s partition: %w", p.table, err)
+		}
 	}
-	partitions, err := p.list(ctx)
+	return nil
+}
+
+// RunOnce 执行一次分区检查，创建未来的分区并删除过期分区
+// 开启锁时，其他实例正在执行则返回ErrPartitionLocked
+func (p *Partition) RunOnce(ctx context.Context) error {
+	return p.runOnce(ctx, 0, true)
+}
+
+// runOnce 执行一次分区检查，timeout为创建分区的超时时间，<=0表示不限制，drop为false时只创建分区
+func (p *Partition) runOnce(ctx context.Context, timeout time.Duration, drop bool) error {
+	addCtx, cancel := contextWithTimeout(ctx, timeout)
+	defer cancel()
+	if p.lock {
+		release, err := p.acquireLock(addCtx)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	plan, err := p.Plan(addCtx)
 	if err != nil {
 		return err
 	}
-	// 删除过期的分区
-	earliestPartition, _ := strconv.Atoi(strings.ReplaceAll(carbon.Now().SubNanoseconds(int(p.retentionDuration.Nanoseconds())).StartOfDay().ToDateString(), "-", ""))
-	for _, partition := range partitions {
-		partitionNum, _ := strconv.Atoi(strings.TrimLeft(partition, "p"))
-		if partitionNum < earliestPartition {
-			sql := fmt.Sprintf(
-				"ALTER TABLE %s DROP PARTITION p%d",
-				p.table,
-				partitionNum,
-			)
-			err = p.db.WithContext(ctx).Exec(sql).Error
-			if err != nil {
-				logx.Error(context.Background(), fmt.Sprintf("drop  table %s partition %s failed", p.table, partition))
-			}
-		}
+	if !drop {
+		return p.addPartitions(addCtx, plan)
 	}
-	return err
+	return p.apply(addCtx, ctx, plan)
 }
 
-// Start 启动分区自动管理
-func (p *partition) Start() {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+// apply 执行分区维护计划，归档及删除过期分区使用单独的超时时间
+func (p *Partition) apply(addCtx context.Context, ctx context.Context, plan *PartitionPlan) error {
+	err := p.addPartitions(addCtx, plan)
+	dropCtx, cancel := contextWithTimeout(ctx, p.archiveTimeout)
 	defer cancel()
-	// 初始化
-	switch p.partitionUnit {
-	// 按天分区
-	case PartitionUnitDay:
-		p.addDayPartition(ctx, 1)
-		p.addDayPartition(ctx, 2)
-	// 按月分区
-	case PartitionUnitMonth:
-		p.addMonthPartition(ctx, 1)
-		p.addMonthPartition(ctx, 2)
-	// 按年分区
-	case PartitionUnitYear:
-		p.addYearPartition(ctx, 1)
-		p.addYearPartition(ctx, 2)
-	default:
-		panic("unsupported partition unit type")
+	return errors.Join(err, p.dropExpiredPartitions(dropCtx, plan))
+}
+
+// contextWithTimeout timeout<=0时不设置超时
+func contextWithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Start 启动分区自动管理
+// 立即执行一次分区检查并返回其错误，之后定时检查，ctx结束或调用Stop()后停止
+func (p *Partition) Start(ctx context.Context) error {
+	if err := p.validateUnit(p.keyType, ""); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel != nil {
+		return ErrPartitionStarted
+	}
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+
+	// 初始化，同步创建分区，归档及删除过期分区耗时较长，在协程中执行，避免阻塞启动
+	err := p.runOnce(ctx, DefaultPartitionTimeout, false)
+	if errors.Is(err, ErrPartitionLocked) {
+		err = nil
+	}
+	// 分区单位与分区键不匹配时无法创建分区，不再定时检查
+	if errors.Is(err, ErrPartitionUnitMismatch) || errors.Is(err, ErrUnsupportedPartitionKey) {
+		p.cancel()
+		p.cancel = nil
+		return err
 	}
 	// 定时检查，并自动创建分区，并删除过期的分区
 	go func() {
-		if DefaultCronDuration < time.Second*10 {
-			DefaultCronDuration = time.Second * 10
+		defer close(p.done)
+		check := func() {
+			err := p.runOnceWithTimeout(ctx)
+			// 已停止
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil && !errors.Is(err, ErrPartitionLocked) {
+				logx.Error(ctx, "partition maintenance failed", logx.String("table", p.table), logx.Err(err))
+			}
+			p.reportStats(ctx)
 		}
-		ticker := time.NewTicker(DefaultCronDuration)
+		check()
+		interval := max(DefaultCronDuration, time.Second*10)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
-			<-ticker.C
-			func() {
-				ctx1, cancel1 := context.WithTimeout(context.Background(), time.Second*30)
-				defer cancel1()
-				switch p.partitionUnit {
-				// 按天分区
-				case PartitionUnitDay:
-					p.addDayPartition(ctx1, 1)
-					p.addDayPartition(ctx1, 2)
-				// 按月分区
-				case PartitionUnitMonth:
-					p.addMonthPartition(ctx1, 1)
-					p.addMonthPartition(ctx1, 2)
-				// 按年分区
-				case PartitionUnitYear:
-					p.addYearPartition(ctx1, 1)
-					p.addYearPartition(ctx1, 2)
-				}
-				p.dropExpiredPartitions(ctx1)
-			}()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				check()
+			}
 		}
 	}()
+	return err
+}
+
+// Stop 停止分区自动管理，等待进行中的检查结束
+func (p *Partition) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.cancel == nil {
+		return
+	}
+	p.cancel()
+	<-p.done
+	p.cancel = nil
+}
+
+// lockName 分区维护锁的名称，mysql限制最长64个字符
+func (p *Partition) lockName() string {
+	name := fmt.Sprintf("gormx:partition:%s.%s", p.database, p.table)
+	if len(name) > 64 {
+		name = fmt.Sprintf("gormx:partition:%x", md5.Sum([]byte(p.database+"."+p.table)))
+	}
+	return name
+}
+
+// acquireLock 获取分区维护锁，不等待
+// 锁与连接绑定，使用独立连接持有锁，实例异常退出时连接断开锁自动释放
+func (p *Partition) acquireLock(ctx context.Context) (release func(), err error) {
+	sqlDB, err := p.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	name := p.lockName()
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, ErrPartitionLocked
+	}
+	return func() {
+		var released sql.NullInt64
+		conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", name).Scan(&released)
+		conn.Close()
+	}, nil
+}
+
+// runOnceWithTimeout 执行一次分区检查，创建分区最长DefaultPartitionTimeout
+func (p *Partition) runOnceWithTimeout(ctx context.Context) error {
+	return p.runOnce(ctx, DefaultPartitionTimeout, true)
 }
@@ -0,0 +1,100 @@
+package gormx
+
+// 分区统计
+// 读取information_schema.PARTITIONS中各分区的行数、数据及索引大小、分区上界
+// 注意：TABLE_ROWS、DATA_LENGTH、INDEX_LENGTH为InnoDB的估算值，依赖统计信息的更新
+//
+// stats, err := partition.Stats(ctx)
+//
+// // 定时检查后回调，可用于导出metrics
+// gormx.WithPartitionStatsHandler(func(ctx context.Context, stats []gormx.PartitionStat) {
+// 	for _, stat := range stats {
+// 		partitionRows.WithLabelValues(stat.Table, stat.Name).Set(float64(stat.Rows))
+// 	}
+// })
+
+import (
+	"context"
+	"time"
+
+	"github.com/itmisx/logx"
+)
+
+// PartitionStat 单个分区的统计信息
+type PartitionStat struct {
+	Table       string    `json:"table"`        // 表名
+	Name        string    `json:"name"`         // 分区名
+	Ordinal     int       `json:"ordinal"`      // 分区序号
+	Description string    `json:"description"`  // 分区上界的值，如 1735660800、'2025-01-01'、MAXVALUE
+	Bound       time.Time `json:"bound"`        // 分区名对应的分区上界，MAXVALUE等分区为零值
+	Rows        int64     `json:"rows"`         // 估计行数
+	DataLength  int64     `json:"data_length"`  // 数据大小(字节)
+	IndexLength int64     `json:"index_length"` // 索引大小(字节)
+}
+
+// WithPartitionStatsHandler Start的首次检查及每次定时检查后获取分区统计并回调，可用于导出metrics
+func WithPartitionStatsHandler(handler func(ctx context.Context, stats []PartitionStat)) PartitionOption {
+	return func(p *Partition) {
+		p.statsHandler = handler
+	}
+}
+
+// partitionStatRow information_schema.PARTITIONS中的分区统计
+type partitionStatRow struct {
+	Name        string
+	Ordinal     int
+	Description string
+	Rows        int64
+	DataLength  int64
+	IndexLength int64
+}
+
+// Stats 获取所有分区的统计信息，按分区顺序
+func (p *Partition) Stats(ctx context.Context) ([]PartitionStat, error) {
+	var rows []partitionStatRow
+	err := p.db.WithContext(ctx).Table("information_schema.PARTITIONS").
+		Select("PARTITION_NAME AS name, PARTITION_ORDINAL_POSITION AS ordinal, PARTITION_DESCRIPTION AS description, "+
+			"TABLE_ROWS AS `rows`, DATA_LENGTH AS data_length, INDEX_LENGTH AS index_length").
+		Where("TABLE_SCHEMA = ?", p.database).
+		Where("TABLE_NAME = ?", p.table).
+		Where("PARTITION_NAME IS NOT NULL").
+		Order("PARTITION_ORDINAL_POSITION").
+		Scan(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	return p.partitionStats(rows), nil
+}
+
+// partitionStats 转换为分区统计，根据分区名解析分区上界
+func (p *Partition) partitionStats(rows []partitionStatRow) []PartitionStat {
+	stats := make([]PartitionStat, 0, len(rows))
+	for _, row := range rows {
+		bound, _ := p.parsePartitionName(row.Name)
+		stats = append(stats, PartitionStat{
+			Table:       p.table,
+			Name:        row.Name,
+			Ordinal:     row.Ordinal,
+			Description: row.Description,
+			Bound:       bound,
+			Rows:        row.Rows,
+			DataLength:  row.DataLength,
+			IndexLength: row.IndexLength,
+		})
+	}
+	return stats
+}
+
+// reportStats 获取分区统计并回调
+func (p *Partition) reportStats(ctx context.Context) {
+	if p.statsHandler == nil {
+		return
+	}
+	stats, err := p.Stats(ctx)
+	if err != nil {
+		logx.Warn(ctx, "get partition stats failed", logx.String("table", p.table), logx.Err(err))
+		return
+	}
+	p.statsHandler(ctx, stats)
+}
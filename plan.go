@@ -0,0 +1,126 @@
+package gormx
+
+// 分区维护计划
+// 计算将要创建和删除的分区及执行的ddl，不执行任何变更，便于上线自动删除前确认
+//
+// plan, err := partition.Plan(ctx)
+// fmt.Println(plan)
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PartitionPlan 分区维护计划
+type PartitionPlan struct {
+	Table      string             `json:"table"`       // 表名
+	Create     []PlannedPartition `json:"create"`      // 将要创建的分区
+	CreateSQLs []string           `json:"create_sqls"` // 创建分区的ddl，存在MAXVALUE分区时为一条REORGANIZE
+	Drop       []PlannedPartition `json:"drop"`        // 将要删除的过期分区
+}
+
+// PlannedPartition 计划中的分区
+type PlannedPartition struct {
+	Name    string    `json:"name"`              // 分区名
+	Bound   time.Time `json:"bound"`             // 分区上界
+	Value   string    `json:"value"`             // 分区上界的取值
+	Rows    int64     `json:"rows"`              // 估计行数，来自information_schema.PARTITIONS.TABLE_ROWS
+	Archive bool      `json:"archive,omitempty"` // 删除前是否归档
+	SQL     string    `json:"sql,omitempty"`     // 删除分区的ddl
+}
+
+// Plan 计算分区维护计划，不执行任何变更
+func (p *Partition) Plan(ctx context.Context) (*PartitionPlan, error) {
+	keyType, err := p.detectKeyType(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dataType string
+	if keyType == PartitionKeyColumns && p.partitionUnit == PartitionUnitHour {
+		if dataType, err = p.columnDataType(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.validateUnit(keyType, dataType); err != nil {
+		return nil, err
+	}
+	partitions, err := p.describe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return p.plan(keyType, partitions, p.now()), nil
+}
+
+// plan 根据现有分区计算分区维护计划
+func (p *Partition) plan(keyType PartitionKeyT, partitions []partitionInfo, now time.Time) *PartitionPlan {
+	plan := &PartitionPlan{Table: p.table}
+	var (
+		names             []string
+		maxValuePartition string
+	)
+	for _, partition := range partitions {
+		names = append(names, partition.Name)
+		if strings.EqualFold(partition.Description, "MAXVALUE") {
+			maxValuePartition = partition.Name
+		}
+	}
+	bounds := p.pendingBounds(names, now)
+	for _, bound := range bounds {
+		plan.Create = append(plan.Create, PlannedPartition{
+			Name:  p.partitionName(bound),
+			Bound: bound,
+			Value: p.rangeValue(keyType, bound),
+		})
+	}
+	plan.CreateSQLs = p.addPartitionSQLs(keyType, bounds, maxValuePartition)
+
+	if p.retentionDuration <= 0 {
+		return plan
+	}
+	earliest := p.earliestBound(now)
+	for _, partition := range partitions {
+		if !p.expired(keyType, partition, earliest) {
+			continue
+		}
+		bound, _ := p.parsePartitionName(partition.Name)
+		plan.Drop = append(plan.Drop, PlannedPartition{
+			Name:    partition.Name,
+			Bound:   bound,
+			Value:   partition.Description,
+			Rows:    partition.Rows,
+			Archive: p.archiver != nil,
+			SQL:     fmt.Sprintf("ALTER TABLE %s DROP PARTITION %s", p.table, partition.Name),
+		})
+	}
+	return plan
+}
+
+// Empty 是否没有需要执行的变更
+func (plan *PartitionPlan) Empty() bool {
+	return len(plan.CreateSQLs) == 0 && len(plan.Drop) == 0
+}
+
+// String 输出可读的计划
+func (plan *PartitionPlan) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table %s: create %d, drop %d\n", plan.Table, len(plan.Create), len(plan.Drop))
+	for _, partition := range plan.Create {
+		fmt.Fprintf(&b, "  + %s VALUES LESS THAN (%s)\n", partition.Name, partition.Value)
+	}
+	for _, partition := range plan.Drop {
+		archive := ""
+		if partition.Archive {
+			archive = ", archive"
+		}
+		fmt.Fprintf(&b, "  - %s VALUES LESS THAN (%s), ~%d rows%s\n", partition.Name, partition.Value, partition.Rows, archive)
+	}
+	for _, sql := range plan.CreateSQLs {
+		fmt.Fprintf(&b, "%s;\n", sql)
+	}
+	for _, partition := range plan.Drop {
+		fmt.Fprintf(&b, "%s;\n", partition.SQL)
+	}
+	return b.String()
+}
@@ -0,0 +1,101 @@
+package gormx
+
+// info级别sql日志采样与限流
+// 错误和慢sql不受影响，始终记录
+//
+// sampler := gormx.NewLogSampler(0.1, 5) // 采样10%，每个sql指纹每秒最多5条
+// db, _ := gormx.New(gormx.Config{..., Debug: true, LogSampler: sampler})
+// sampler.Suppressed() // 被抑制的日志条数
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 被抑制日志条数的输出间隔
+var DefaultSuppressedReportInterval = time.Minute
+
+// LogSampler info级别sql日志采样器
+type LogSampler struct {
+	rate  float64 // 采样率(0,1]，<=0或>=1表示不按比例采样
+	limit int     // 每个sql指纹每秒最多记录的条数，<=0表示不限制
+
+	mu         sync.Mutex
+	second     int64          // 当前计数的秒
+	counts     map[string]int // 当前秒内每个指纹已记录的条数
+	suppressed int64          // 累计被抑制的条数
+	pending    int64          // 上次输出后被抑制的条数
+	lastReport time.Time      // 上次输出被抑制条数的时间
+}
+
+// NewLogSampler 实例化采样器
+// rate 按比例采样，limit 每个sql指纹每秒最多记录的条数
+func NewLogSampler(rate float64, limit int) *LogSampler {
+	return &LogSampler{
+		rate:       rate,
+		limit:      limit,
+		counts:     make(map[string]int),
+		lastReport: time.Now(),
+	}
+}
+
+// Allow 是否记录该sql
+func (s *LogSampler) Allow(sql string) bool {
+	if s == nil {
+		return true
+	}
+	allow := true
+	if s.rate > 0 && s.rate < 1 && rand.Float64() >= s.rate {
+		allow = false
+	}
+	var fp string
+	if allow && s.limit > 0 {
+		fp = Fingerprint(sql)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if allow && s.limit > 0 {
+		if now := time.Now().Unix(); now != s.second {
+			s.second = now
+			clear(s.counts)
+		}
+		if s.counts[fp] >= s.limit {
+			allow = false
+		} else {
+			s.counts[fp]++
+		}
+	}
+	if !allow {
+		s.suppressed++
+		s.pending++
+	}
+	return allow
+}
+
+// Suppressed 累计被抑制的日志条数
+func (s *LogSampler) Suppressed() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.suppressed
+}
+
+// report 到达输出间隔时，返回上次输出后被抑制的条数
+func (s *LogSampler) report() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == 0 || time.Since(s.lastReport) < DefaultSuppressedReportInterval {
+		return 0
+	}
+	n := s.pending
+	s.pending = 0
+	s.lastReport = time.Now()
+	return n
+}
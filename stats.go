@@ -0,0 +1,222 @@
+package gormx
+
+// sql聚合统计，类似pg_stat_statements
+// 按sql指纹聚合执行次数、耗时、影响行数、错误数
+//
+// stats := gormx.NewSqlStats()
+// db, _ := gormx.New(gormx.Config{..., SqlStats: stats})
+// stats.StartReport(ctx, time.Minute, 10) // 每分钟输出耗时top10的sql
+// stats.Snapshot()                         // 获取统计快照
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/itmisx/logx"
+	logger "gorm.io/gorm/logger"
+)
+
+var (
+	// 每个指纹保留的耗时样本数，用于计算分位数
+	DefaultSqlStatsSamples = 1024
+	// 最多统计的指纹数，超出后新的指纹不再统计
+	DefaultSqlStatsMaxFingerprints = 2000
+)
+
+// SqlStat 单个sql指纹的统计信息
+type SqlStat struct {
+	Fingerprint string           // sql指纹
+	Sample      string           // 最近一次执行的sql
+	Calls       int64            // 执行次数
+	Errors      int64            // 错误次数
+	Rows        int64            // 总影响行数
+	TotalTime   time.Duration    // 总耗时
+	MinTime     time.Duration    // 最小耗时
+	MaxTime     time.Duration    // 最大耗时
+	MeanTime    time.Duration    // 平均耗时
+	P50Time     time.Duration    // 耗时p50
+	P99Time     time.Duration    // 耗时p99
+	LastSeen    time.Time        // 最近一次执行时间
+	Nodes       map[string]int64 // 各执行节点的执行次数
+}
+
+type sqlStatEntry struct {
+	SqlStat
+	samples []time.Duration // 耗时样本（环形）
+	next    int             // 下一个样本写入位置
+}
+
+// SqlStats sql统计器
+type SqlStats struct {
+	mu              sync.Mutex
+	entries         map[string]*sqlStatEntry
+	samples         int   // 每个指纹保留的耗时样本数
+	maxFingerprints int   // 最多统计的指纹数
+	dropped         int64 // 因指纹数超限而未统计的执行次数
+}
+
+// NewSqlStats 实例化sql统计器
+func NewSqlStats() *SqlStats {
+	return &SqlStats{
+		entries:         make(map[string]*sqlStatEntry),
+		samples:         max(DefaultSqlStatsSamples, 1),
+		maxFingerprints: DefaultSqlStatsMaxFingerprints,
+	}
+}
+
+// Record 记录一次sql执行
+func (s *SqlStats) Record(sql string, elapsed time.Duration, rows int64, err error) {
+	s.record("", sql, elapsed, rows, err)
+}
+
+// record 记录一次sql执行及执行节点
+func (s *SqlStats) record(node string, sql string, elapsed time.Duration, rows int64, err error) {
+	if s == nil {
+		return
+	}
+	fp := Fingerprint(sql)
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[fp]
+	if !ok {
+		if len(s.entries) >= s.maxFingerprints {
+			s.dropped++
+			return
+		}
+		entry = &sqlStatEntry{
+			SqlStat: SqlStat{Fingerprint: fp, MinTime: elapsed, Nodes: make(map[string]int64)},
+			samples: make([]time.Duration, 0, min(s.samples, 64)),
+		}
+		s.entries[fp] = entry
+	}
+	entry.Sample = trimResolverMode(sql)
+	entry.Calls++
+	if err != nil && !errors.Is(err, logger.ErrRecordNotFound) {
+		entry.Errors++
+	}
+	if rows > 0 {
+		entry.Rows += rows
+	}
+	entry.TotalTime += elapsed
+	entry.MinTime = min(entry.MinTime, elapsed)
+	entry.MaxTime = max(entry.MaxTime, elapsed)
+	entry.LastSeen = now
+	if node != "" {
+		entry.Nodes[node]++
+	}
+	if len(entry.samples) < s.samples {
+		entry.samples = append(entry.samples, elapsed)
+	} else {
+		entry.samples[entry.next] = elapsed
+		entry.next = (entry.next + 1) % s.samples
+	}
+}
+
+// Snapshot 获取统计快照，按总耗时降序
+func (s *SqlStats) Snapshot() []SqlStat {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	stats := make([]SqlStat, 0, len(s.entries))
+	samples := make([][]time.Duration, 0, len(s.entries))
+	for _, entry := range s.entries {
+		stat := entry.SqlStat
+		stat.Nodes = make(map[string]int64, len(entry.Nodes))
+		for node, calls := range entry.Nodes {
+			stat.Nodes[node] = calls
+		}
+		stats = append(stats, stat)
+		samples = append(samples, append([]time.Duration(nil), entry.samples...))
+	}
+	s.mu.Unlock()
+
+	// 计算均值和分位数
+	for i := range stats {
+		stats[i].MeanTime = stats[i].TotalTime / time.Duration(stats[i].Calls)
+		sort.Slice(samples[i], func(a, b int) bool { return samples[i][a] < samples[i][b] })
+		stats[i].P50Time = percentile(samples[i], 0.50)
+		stats[i].P99Time = percentile(samples[i], 0.99)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].TotalTime > stats[j].TotalTime })
+	return stats
+}
+
+// Top 获取总耗时最高的n条统计
+func (s *SqlStats) Top(n int) []SqlStat {
+	stats := s.Snapshot()
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// Dropped 因指纹数超限而未统计的执行次数
+func (s *SqlStats) Dropped() int64 {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Reset 清空统计
+func (s *SqlStats) Reset() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = make(map[string]*sqlStatEntry)
+	s.dropped = 0
+}
+
+// StartReport 定期输出耗时topN的sql统计，ctx结束后停止
+func (s *SqlStats) StartReport(ctx context.Context, interval time.Duration, topN int) {
+	if interval < time.Second*10 {
+		interval = time.Second * 10
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for i, stat := range s.Top(topN) {
+					logx.Info(context.Background(),
+						"sql stats",
+						logx.Int("rank", i+1),
+						logx.String("fingerprint", stat.Fingerprint),
+						logx.Int64("calls", stat.Calls),
+						logx.Int64("errors", stat.Errors),
+						logx.Int64("rows", stat.Rows),
+						logx.Float64("total[ms]", float64(stat.TotalTime.Nanoseconds())/1e6),
+						logx.Float64("mean[ms]", float64(stat.MeanTime.Nanoseconds())/1e6),
+						logx.Float64("p50[ms]", float64(stat.P50Time.Nanoseconds())/1e6),
+						logx.Float64("p99[ms]", float64(stat.P99Time.Nanoseconds())/1e6),
+						logx.Float64("max[ms]", float64(stat.MaxTime.Nanoseconds())/1e6),
+						logx.Any("nodes", stat.Nodes),
+					)
+				}
+			}
+		}
+	}()
+}
+
+// percentile 计算已排序样本的分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return sorted[idx]
+}
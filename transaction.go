@@ -0,0 +1,91 @@
+package gormx
+
+// 事务自动重试
+// 事务因死锁(1213)、锁等待超时(1205)失败时，按指数退避自动重试整个事务
+//
+// err := gormx.RetryTransaction(ctx, db, func(tx *gorm.DB) error {
+// 	...
+// }, gormx.RetryOptions{MaxAttempts: 5})
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+
+	"github.com/itmisx/logx"
+	"gorm.io/gorm"
+)
+
+// RetryOptions 事务重试参数
+type RetryOptions struct {
+	MaxAttempts    int                                                                      // 最大执行次数(含首次)，默认3
+	InitialBackoff time.Duration                                                            // 首次重试的等待时间，默认50ms，之后每次翻倍
+	MaxBackoff     time.Duration                                                            // 最大等待时间，默认1s
+	Retryable      func(err error) bool                                                     // 是否可重试，默认死锁和锁等待超时
+	OnRetry        func(ctx context.Context, attempt int, err error, backoff time.Duration) // 每次重试前回调，可用于记录metrics
+	TxOptions      *sql.TxOptions                                                           // 事务参数
+}
+
+// IsRetryable 默认的可重试错误：死锁、锁等待超时
+func IsRetryable(err error) bool {
+	return IsDeadlock(err) || IsLockWaitTimeout(err)
+}
+
+// RetryTransaction 执行事务，失败且可重试时自动重试
+// db已在事务中时，死锁等错误已导致外层事务回滚，只执行一次并返回错误，由外层事务重试
+func RetryTransaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error, opts RetryOptions) error {
+	var txOpts []*sql.TxOptions
+	if opts.TxOptions != nil {
+		txOpts = append(txOpts, opts.TxOptions)
+	}
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok {
+		return db.WithContext(ctx).Transaction(fn, txOpts...)
+	}
+	return retry(ctx, opts, func() error {
+		return db.WithContext(ctx).Transaction(fn, txOpts...)
+	})
+}
+
+// retry 执行fn，失败且可重试时按指数退避重试
+func retry(ctx context.Context, opts RetryOptions, fn func() error) (err error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = time.Millisecond * 50
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Second
+	}
+	if opts.Retryable == nil {
+		opts.Retryable = IsRetryable
+	}
+
+	backoff := opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= opts.MaxAttempts || !opts.Retryable(err) {
+			return err
+		}
+		// 随机抖动，避免冲突的事务同时重试
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		logx.Warn(ctx,
+			"transaction retry",
+			logx.Int("attempt", attempt),
+			logx.String("err", err.Error()),
+			logx.String("err_class", ErrorClass(err)),
+			logx.Float64("backoff[ms]", float64(wait.Nanoseconds())/1e6))
+		if opts.OnRetry != nil {
+			opts.OnRetry(ctx, attempt, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, opts.MaxBackoff)
+	}
+}